@@ -0,0 +1,63 @@
+package analyzer
+
+import (
+	"sort"
+
+	"github.com/mathieunls/deepchange-downloader/pogo"
+)
+
+//AUC returns the area under the ROC curve of the GlmProb of the commits
+//against ContainsBug, i.e. the probability that a buggy commit is scored
+//higher than a clean one. Ties count for half
+func AUC(commits []*pogo.Commit) float64 {
+
+	scores := make([]float64, len(commits))
+	labels := make([]bool, len(commits))
+
+	for i, commit := range commits {
+		scores[i] = commit.GlmProb
+		labels[i] = commit.ContainsBug
+	}
+
+	return auc(scores, labels)
+}
+
+//auc computes the Mann-Whitney U statistic normalized by the number of
+//buggy and clean pairs, 0.5 when either class is empty
+func auc(scores []float64, labels []bool) float64 {
+
+	order := make([]int, len(scores))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return scores[order[i]] < scores[order[j]] })
+
+	positives := 0.0
+	rankSum := 0.0
+
+	for i := 0; i < len(order); {
+
+		//Tied scores share their average rank
+		j := i
+		for j < len(order) && scores[order[j]] == scores[order[i]] {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+
+		for k := i; k < j; k++ {
+			if labels[order[k]] {
+				positives++
+				rankSum += rank
+			}
+		}
+
+		i = j
+	}
+
+	negatives := float64(len(scores)) - positives
+	if positives == 0 || negatives == 0 {
+		return 0.5
+	}
+
+	return (rankSum - positives*(positives+1)/2) / (positives * negatives)
+}
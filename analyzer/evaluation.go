@@ -0,0 +1,262 @@
+package analyzer
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/mathieunls/deepchange-downloader/pogo"
+)
+
+//Split is a partition of commits into a training and a testing set
+type Split struct {
+	Train []*pogo.Commit
+	Test  []*pogo.Commit
+}
+
+//Evaluation holds the performance of a model on the testing set of a split
+type Evaluation struct {
+	Train      int
+	Test       int
+	Buggy      int
+	Precision  float64
+	Recall     float64
+	F1         float64
+	AUC        float64
+	Popt       float64
+	RecallAt20 float64
+}
+
+//TimeSplit sorts the commits by author date and tests on the latest
+//testRatio of them. The model is trained on the commits authored at
+//least gap before the first tested one: the bugs of the most recent
+//commits aren't fixed yet when a model is trained in practice.
+//It fails unless testRatio is between 0 and 1, both excluded
+func TimeSplit(commits []*pogo.Commit, testRatio float64, gap time.Duration) (Split, error) {
+
+	if testRatio <= 0 || testRatio >= 1 {
+		return Split{}, errors.New("test ratio: " + strconv.FormatFloat(testRatio, 'f', -1, 64) + " is not between 0 and 1")
+	}
+
+	sorted := byDate(commits)
+	first := len(sorted) - int(math.Round(float64(len(sorted))*testRatio))
+
+	return gapSplit(sorted, first, len(sorted), gap), nil
+}
+
+//TimeSplits sorts the commits by author date, cuts them into folds+1
+//consecutive periods of as many commits and returns one split per fold:
+//the ith tests on the period i+1 and trains on the periods before it,
+//minus the gap, as in TimeSplit
+func TimeSplits(commits []*pogo.Commit, folds int, gap time.Duration) []Split {
+
+	sorted := byDate(commits)
+	splits := []Split{}
+
+	for fold := 1; fold <= folds; fold++ {
+		first := len(sorted) * fold / (folds + 1)
+		last := len(sorted) * (fold + 1) / (folds + 1)
+		splits = append(splits, gapSplit(sorted, first, last, gap))
+	}
+
+	return splits
+}
+
+//byDate returns the commits sorted by author date, merges excluded as
+//the model is trained without them
+func byDate(commits []*pogo.Commit) []*pogo.Commit {
+
+	sorted := []*pogo.Commit{}
+	for _, commit := range commits {
+		if !commit.IsMerge() {
+			sorted = append(sorted, commit)
+		}
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].AuthorDateUnixTimestamp < sorted[j].AuthorDateUnixTimestamp
+	})
+
+	return sorted
+}
+
+//gapSplit tests on sorted[first:last] and trains on the commits
+//authored at least gap before sorted[first]
+func gapSplit(sorted []*pogo.Commit, first int, last int, gap time.Duration) Split {
+
+	split := Split{Test: sorted[first:last]}
+
+	if first == last {
+		return split
+	}
+
+	until := sorted[first].AuthorDateUnixTimestamp - int(gap.Seconds())
+	for _, commit := range sorted[:first] {
+		if commit.AuthorDateUnixTimestamp < until {
+			split.Train = append(split.Train, commit)
+		}
+	}
+
+	return split
+}
+
+//Evaluate trains model on the training set of split and measures its
+//predictions on the testing set, a commit being predicted buggy when its
+//probability is at least threshold. The GlmProb of the commits is untouched
+func Evaluate(model Model, split Split, threshold float64) (*Evaluation, error) {
+
+	if len(split.Test) == 0 {
+		return nil, errors.New("the testing set is empty")
+	}
+
+	if err := model.Train(split.Train); err != nil {
+		return nil, err
+	}
+
+	evaluation := &Evaluation{Train: len(split.Train), Test: len(split.Test)}
+
+	scores := make([]float64, len(split.Test))
+	labels := make([]bool, len(split.Test))
+	truePositives := 0.0
+	predicted := 0.0
+
+	for i, commit := range split.Test {
+
+		scores[i] = model.Predict(commit)
+		labels[i] = commit.ContainsBug
+
+		if commit.ContainsBug {
+			evaluation.Buggy++
+		}
+
+		if scores[i] >= threshold {
+			predicted++
+			if commit.ContainsBug {
+				truePositives++
+			}
+		}
+	}
+
+	if predicted > 0 {
+		evaluation.Precision = truePositives / predicted
+	}
+
+	if evaluation.Buggy > 0 {
+		evaluation.Recall = truePositives / float64(evaluation.Buggy)
+	}
+
+	if evaluation.Precision+evaluation.Recall > 0 {
+		evaluation.F1 = 2 * evaluation.Precision * evaluation.Recall / (evaluation.Precision + evaluation.Recall)
+	}
+
+	evaluation.AUC = auc(scores, labels)
+	evaluation.Popt, evaluation.RecallAt20 = effortAware(split.Test, scores)
+
+	return evaluation, nil
+}
+
+//String returns a one line summary of the evaluation
+func (evaluation *Evaluation) String() string {
+
+	format := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', 4, 64)
+	}
+
+	return "train: " + strconv.Itoa(evaluation.Train) +
+		" test: " + strconv.Itoa(evaluation.Test) +
+		" buggy: " + strconv.Itoa(evaluation.Buggy) +
+		" precision: " + format(evaluation.Precision) +
+		" recall: " + format(evaluation.Recall) +
+		" f1: " + format(evaluation.F1) +
+		" auc: " + format(evaluation.AUC) +
+		" popt: " + format(evaluation.Popt) +
+		" recall@20%: " + format(evaluation.RecallAt20)
+}
+
+//effort is the amount of lines to review to inspect commit, at least one
+func effort(commit *pogo.Commit) float64 {
+	return math.Max(float64(commit.LineAdded+commit.LineDeleted), 1)
+}
+
+//effortAware returns the Popt and the recall at 20% of the reviewed lines
+//when the commits are inspected by decreasing risk per line, as in Kamei
+//et al. Popt compares the area under the cumulative lift chart of the model
+//to the areas of the optimal and worst orderings, 1 being the optimal
+func effortAware(commits []*pogo.Commit, scores []float64) (float64, float64) {
+
+	buggy := make([]float64, len(commits))
+	for i, commit := range commits {
+		if commit.ContainsBug {
+			buggy[i] = 1
+		}
+	}
+
+	//Buggy commits come first, the smallest first
+	optimalDensity := make([]float64, len(commits))
+	predictedDensity := make([]float64, len(commits))
+	for i, commit := range commits {
+		optimalDensity[i] = buggy[i] / effort(commit)
+		predictedDensity[i] = scores[i] / effort(commit)
+	}
+
+	optimal, _ := liftChart(commits, buggy, optimalDensity)
+	predicted, recallAt20 := liftChart(commits, buggy, predictedDensity)
+
+	//Clean commits come first, then the buggy ones, the biggest first
+	worstDensity := make([]float64, len(commits))
+	for i, commit := range commits {
+		worstDensity[i] = -buggy[i] - 1/effort(commit)
+	}
+	worst, _ := liftChart(commits, buggy, worstDensity)
+
+	if optimal == worst {
+		return 1, recallAt20
+	}
+
+	return 1 - (optimal-predicted)/(optimal-worst), recallAt20
+}
+
+//liftChart inspects the commits by decreasing density and returns the area
+//under the curve of the ratio of bugs found over the ratio of lines reviewed,
+//along with the ratio of bugs found after reviewing 20% of the lines
+func liftChart(commits []*pogo.Commit, buggy []float64, density []float64) (float64, float64) {
+
+	order := make([]int, len(commits))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return density[order[i]] > density[order[j]] })
+
+	totalEffort := 0.0
+	totalBugs := 0.0
+	for i, commit := range commits {
+		totalEffort += effort(commit)
+		totalBugs += buggy[i]
+	}
+
+	if totalBugs == 0 {
+		return 0, 0
+	}
+
+	area := 0.0
+	x, y := 0.0, 0.0
+	recallAt20 := 0.0
+
+	for _, i := range order {
+
+		nextX := x + effort(commits[i])/totalEffort
+		nextY := y + buggy[i]/totalBugs
+
+		area += (nextX - x) * (y + nextY) / 2
+
+		if nextX <= 0.2 {
+			recallAt20 = nextY
+		}
+
+		x, y = nextX, nextY
+	}
+
+	return area, recallAt20
+}
@@ -0,0 +1,39 @@
+package analyzer
+
+import (
+	"math"
+
+	"github.com/mathieunls/deepchange-downloader/pogo"
+)
+
+//Features are the names of the Kamei et al. change
+//metrics the models are trained on, in order
+var Features = []string{
+	"LA", "LD", "LT", "NF", "NS", "ND",
+	"Age", "NUC", "Exp", "RExp", "SExp", "Entropy",
+}
+
+//features returns the metrics of commit in the order of Features.
+//The metrics are skewed counts, they are log transformed as in
+//Kamei et al. except the entropy which ranges from 0 to 1
+func features(commit *pogo.Commit) []float64 {
+
+	return []float64{
+		logTransform(float64(commit.LineAdded)),
+		logTransform(float64(commit.LineDeleted)),
+		logTransform(commit.LineTotal),
+		logTransform(float64(commit.Files)),
+		logTransform(float64(commit.Subsystems)),
+		logTransform(float64(commit.Directories)),
+		logTransform(commit.Age),
+		logTransform(float64(commit.UniqueChange)),
+		logTransform(commit.Exp),
+		logTransform(commit.RExp),
+		logTransform(commit.Sexp),
+		commit.Entrophy,
+	}
+}
+
+func logTransform(value float64) float64 {
+	return math.Log1p(math.Max(value, 0))
+}
@@ -1 +1,250 @@
 package analyzer
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mathieunls/deepchange-downloader/pogo"
+)
+
+//Model predicts the probability that a commit introduces a bug
+type Model interface {
+	Train(commits []*pogo.Commit) error
+	Predict(commit *pogo.Commit) float64
+}
+
+//Logistic is a logistic regression (GLM with a logit link) of
+//ContainsBug over the Features, fitted by iteratively reweighted
+//least squares. The features are standardized before the fit
+type Logistic struct {
+	Coefficients  []float64
+	Mean          []float64
+	Std           []float64
+	Ridge         float64
+	MaxIterations int
+	Tolerance     float64
+	Iterations    int
+}
+
+//NewLogistic returns an untrained logistic regression
+func NewLogistic() *Logistic {
+
+	model := &Logistic{}
+
+	//The size metrics (NF, ND, NS and LA, LD) are highly correlated,
+	//a light L2 penalty keeps the fit stable where plain ML diverges
+	model.Ridge = 1e-4
+	model.MaxIterations = 50
+	model.Tolerance = 1e-8
+
+	return model
+}
+
+//Train fits the model on the commits, merges excluded. It fails
+//when the commits aren't made of both buggy and clean ones
+func (model *Logistic) Train(commits []*pogo.Commit) error {
+
+	x := [][]float64{}
+	y := []float64{}
+	buggy := 0
+
+	for _, commit := range commits {
+
+		if commit.IsMerge() {
+			continue
+		}
+
+		x = append(x, features(commit))
+
+		if commit.ContainsBug {
+			y = append(y, 1)
+			buggy++
+		} else {
+			y = append(y, 0)
+		}
+	}
+
+	if buggy == 0 || buggy == len(y) {
+		return errors.New("training requires both buggy and clean commits, got " +
+			strconv.Itoa(buggy) + " buggy out of " + strconv.Itoa(len(y)))
+	}
+
+	model.standardize(x)
+
+	//Design matrix with the intercept as first column
+	for i := range x {
+		x[i] = append([]float64{1}, model.scale(x[i])...)
+	}
+
+	size := len(Features) + 1
+	beta := make([]float64, size)
+
+	for model.Iterations = 1; model.Iterations <= model.MaxIterations; model.Iterations++ {
+
+		gradient := make([]float64, size)
+		hessian := make([][]float64, size)
+		for j := range hessian {
+			hessian[j] = make([]float64, size)
+		}
+
+		for i, row := range x {
+
+			p := sigmoid(dot(beta, row))
+			w := math.Max(p*(1-p), 1e-10)
+
+			for j := range row {
+				gradient[j] += (y[i] - p) * row[j]
+				for k := range row {
+					hessian[j][k] += w * row[j] * row[k]
+				}
+			}
+		}
+
+		//The intercept isn't penalized
+		for j := 1; j < size; j++ {
+			gradient[j] -= model.Ridge * beta[j]
+			hessian[j][j] += model.Ridge
+		}
+
+		step, err := solve(hessian, gradient)
+		if err != nil {
+			return err
+		}
+
+		change := 0.0
+		for j := range beta {
+			beta[j] += step[j]
+			change = math.Max(change, math.Abs(step[j]))
+		}
+
+		if change < model.Tolerance {
+			break
+		}
+	}
+
+	model.Coefficients = beta
+
+	return nil
+}
+
+//Predict returns the probability that commit introduces a bug
+func (model *Logistic) Predict(commit *pogo.Commit) float64 {
+	return sigmoid(dot(model.Coefficients, append([]float64{1}, model.scale(features(commit))...)))
+}
+
+//String returns the coefficients of the model, on the standardized features
+func (model *Logistic) String() string {
+
+	lines := []string{"Intercept: " + strconv.FormatFloat(model.Coefficients[0], 'f', 6, 64)}
+
+	for i, name := range Features {
+		lines = append(lines, name+": "+strconv.FormatFloat(model.Coefficients[i+1], 'f', 6, 64))
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+//Score sets the GlmProb of the commits to the prediction of model
+func Score(model Model, commits []*pogo.Commit) {
+
+	for _, commit := range commits {
+		commit.GlmProb = model.Predict(commit)
+	}
+}
+
+//standardize computes the mean and standard deviation of the features
+func (model *Logistic) standardize(x [][]float64) {
+
+	model.Mean = make([]float64, len(Features))
+	model.Std = make([]float64, len(Features))
+
+	for _, row := range x {
+		for j, value := range row {
+			model.Mean[j] += value / float64(len(x))
+		}
+	}
+
+	for _, row := range x {
+		for j, value := range row {
+			model.Std[j] += (value - model.Mean[j]) * (value - model.Mean[j]) / float64(len(x))
+		}
+	}
+
+	for j := range model.Std {
+		model.Std[j] = math.Sqrt(model.Std[j])
+
+		//A constant feature is only centered
+		if model.Std[j] == 0 {
+			model.Std[j] = 1
+		}
+	}
+}
+
+func (model *Logistic) scale(row []float64) []float64 {
+
+	scaled := make([]float64, len(row))
+
+	for j, value := range row {
+		scaled[j] = (value - model.Mean[j]) / model.Std[j]
+	}
+
+	return scaled
+}
+
+func sigmoid(z float64) float64 {
+	return 1 / (1 + math.Exp(-z))
+}
+
+func dot(a []float64, b []float64) float64 {
+
+	sum := 0.0
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+
+	return sum
+}
+
+//solve solves a.x = b by Gaussian elimination with partial pivoting
+func solve(a [][]float64, b []float64) ([]float64, error) {
+
+	n := len(b)
+
+	for col := 0; col < n; col++ {
+
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return nil, errors.New("singular system, the features are collinear")
+		}
+
+		a[col], a[pivot] = a[pivot], a[col]
+		b[col], b[pivot] = b[pivot], b[col]
+
+		for row := col + 1; row < n; row++ {
+			factor := a[row][col] / a[col][col]
+			for k := col; k < n; k++ {
+				a[row][k] -= factor * a[col][k]
+			}
+			b[row] -= factor * b[col]
+		}
+	}
+
+	x := make([]float64, n)
+	for row := n - 1; row >= 0; row-- {
+		sum := b[row]
+		for k := row + 1; k < n; k++ {
+			sum -= a[row][k] * x[k]
+		}
+		x[row] = sum / a[row][row]
+	}
+
+	return x, nil
+}
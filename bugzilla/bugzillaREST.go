@@ -0,0 +1,274 @@
+package bugzilla
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mathieunls/deepchange-downloader/pogo"
+)
+
+//RESTBugzillaLinker links Bugzilla reports using the REST API of Bugzilla 5:
+//the bug and its comments, at BaseURL/rest/bug/<id> and BaseURL/rest/bug/<id>/comment.
+//The responses are read from ArchiveDir first, as bug/<id>.json and
+//bug/<id>/comment.json, and the downloaded ones are archived there.
+//Without BaseURL, it reads the archive only
+type RESTBugzillaLinker struct {
+	BaseURL           string
+	APIKey            string
+	ArchiveDir        string
+	DatabaseName      string
+	RequestsPerSecond float64
+	Retries           int
+	Backoff           time.Duration
+	Client            *http.Client
+
+	mutex       sync.Mutex
+	lastRequest time.Time
+}
+
+//apiError is the body of the failed requests
+type apiError struct {
+	Message string `json:"message"`
+}
+
+//bugsJSON is the body of /rest/bug/<id>
+type bugsJSON struct {
+	Bugs []bugJSON `json:"bugs"`
+}
+
+type bugJSON struct {
+	ID         int64  `json:"id"`
+	Created    string `json:"creation_time"`
+	Changed    string `json:"last_change_time"`
+	Title      string `json:"summary"`
+	Status     string `json:"status"`
+	Resolution string `json:"resolution"`
+	Product    string `json:"product"`
+	Component  string `json:"component"`
+	Version    string `json:"version"`
+	Severity   string `json:"severity"`
+	Type       string `json:"type"`
+	Reporter   string `json:"creator"`
+	Assignee   string `json:"assigned_to"`
+}
+
+//commentsJSON is the body of /rest/bug/<id>/comment
+type commentsJSON struct {
+	Bugs map[string]struct {
+		Comments []commentJSON `json:"comments"`
+	} `json:"bugs"`
+}
+
+type commentJSON struct {
+	Count     int    `json:"count"`
+	Commenter string `json:"creator"`
+	Date      string `json:"creation_time"`
+	Text      string `json:"text"`
+}
+
+//Fetch fetches a report and its comments using the REST API
+//It expects ids to look like bug 1234, #1234 or 1234
+func (linker *RESTBugzillaLinker) Fetch(id string) (pogo.Report, error) {
+
+	id = bugNumber(id)
+
+	bugs := bugsJSON{}
+	if err := linker.get("bug/"+id, &bugs); err != nil {
+		return nil, err
+	}
+
+	if len(bugs.Bugs) == 0 {
+		return nil, errors.New("bug " + id + ": no bug")
+	}
+
+	comments := commentsJSON{}
+	if err := linker.get("bug/"+id+"/comment", &comments); err != nil {
+		return nil, err
+	}
+
+	bug := bugs.Bugs[0]
+
+	r := BzReport{}
+	r.ExternalID = linker.DatabaseName + "_" + strconv.FormatInt(bug.ID, 10)
+	r.Date = bug.Created
+	r.Type = bug.Type
+	r.Title = bug.Title
+	r.Product = bug.Product
+	r.Component = bug.Component
+	r.Version = bug.Version
+	r.Severity = bug.Severity
+	r.Resolution = bug.Resolution
+	r.Reporter = bug.Reporter
+	r.Assignee = bug.Assignee
+
+	if resolved(bug.Status) {
+		r.DateClosed = bug.Changed
+	}
+
+	for _, comment := range comments.Bugs[id].Comments {
+
+		r.Comments = append(r.Comments, &Comment{
+			Commenter: comment.Commenter,
+			Order:     comment.Count,
+			Date:      comment.Date,
+			Text:      comment.Text})
+
+		//The first comment of a bug is its description
+		if comment.Count == 0 {
+			r.Description = comment.Text
+			continue
+		}
+
+		r.ReportAttributes.Comments = append(r.ReportAttributes.Comments, pogo.CommentAttribut{
+			Commenter: comment.Commenter,
+			Date:      comment.Date,
+			Text:      comment.Text})
+	}
+
+	return &r, nil
+}
+
+//DBName returns the name of the tracker, prefixing the reports
+func (linker *RESTBugzillaLinker) DBName() string {
+	return linker.DatabaseName
+}
+
+//Cached returns the report cached as attributes
+func (linker *RESTBugzillaLinker) Cached(attributes pogo.ReportAttributes) pogo.Report {
+	return &BzReport{ReportAttributes: attributes}
+}
+
+//get decodes the response of the REST API to resource, from the archive if
+//present. Downloaded responses are archived before being decoded
+func (linker *RESTBugzillaLinker) get(resource string, response interface{}) error {
+
+	archive := filepath.Join(linker.ArchiveDir, filepath.FromSlash(resource)+".json")
+
+	content, err := []byte(nil), errors.New(resource+": not archived in "+linker.ArchiveDir)
+	if linker.ArchiveDir != "" {
+		content, err = ioutil.ReadFile(archive)
+	}
+
+	if err != nil {
+
+		if linker.BaseURL == "" {
+			return err
+		}
+
+		if content, err = linker.download(resource); err != nil {
+			return err
+		}
+
+		if linker.ArchiveDir != "" {
+			if err = os.MkdirAll(filepath.Dir(archive), 0755); err == nil {
+				err = ioutil.WriteFile(archive, content, 0644)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = json.Unmarshal(content, response); err != nil {
+		return errors.New(resource + ": " + err.Error())
+	}
+
+	return nil
+}
+
+//download requests resource, at most RequestsPerSecond times a second.
+//Failed connections, 429 and 5xx responses are retried Retries times,
+//waiting Backoff, doubled at each retry, or the Retry-After of the response
+func (linker *RESTBugzillaLinker) download(resource string) ([]byte, error) {
+
+	url := strings.TrimSuffix(linker.BaseURL, "/") + "/rest/" + resource
+
+	client := linker.Client
+	if client == nil {
+		client = &http.Client{Timeout: time.Minute}
+	}
+
+	for attempt := 0; ; attempt++ {
+
+		linker.wait()
+
+		content, retryAfter, err := linker.request(client, url)
+
+		if err == nil || retryAfter < 0 || attempt >= linker.Retries {
+			return content, err
+		}
+
+		if backoff := linker.Backoff << uint(attempt); backoff > retryAfter {
+			retryAfter = backoff
+		}
+
+		time.Sleep(retryAfter)
+	}
+}
+
+//request requests url once. On failure, it returns how long to wait before
+//retrying, negative when the request is not worth retrying
+func (linker *RESTBugzillaLinker) request(client *http.Client, url string) ([]byte, time.Duration, error) {
+
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	request.Header.Set("Accept", "application/json")
+	if linker.APIKey != "" {
+		request.Header.Set("X-BUGZILLA-API-KEY", linker.APIKey)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer response.Body.Close()
+
+	content, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if response.StatusCode == http.StatusOK {
+		return content, 0, nil
+	}
+
+	message := response.Status
+	failure := apiError{}
+	if json.Unmarshal(content, &failure) == nil && failure.Message != "" {
+		message += ", " + failure.Message
+	}
+	err = errors.New(url + ": " + message)
+
+	if response.StatusCode != http.StatusTooManyRequests && response.StatusCode < 500 {
+		return nil, -1, err
+	}
+
+	seconds, _ := strconv.Atoi(response.Header.Get("Retry-After"))
+
+	return nil, time.Duration(seconds) * time.Second, err
+}
+
+//wait waits for the next request to be allowed by RequestsPerSecond
+func (linker *RESTBugzillaLinker) wait() {
+
+	linker.mutex.Lock()
+	defer linker.mutex.Unlock()
+
+	if linker.RequestsPerSecond > 0 {
+		next := linker.lastRequest.Add(time.Duration(float64(time.Second) / linker.RequestsPerSecond))
+		time.Sleep(time.Until(next))
+	}
+
+	linker.lastRequest = time.Now()
+}
@@ -0,0 +1,168 @@
+package bugzilla
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const bugBody = `{"bugs":[{"id":42,"creation_time":"2013-01-01T18:20:00Z","last_change_time":"2013-01-03T10:00:00Z",` +
+	`"summary":"Crash on start","status":"RESOLVED","resolution":"FIXED","product":"Core","creator":"alice"}]}`
+
+const commentBody = `{"bugs":{"42":{"comments":[` +
+	`{"count":0,"creator":"alice","creation_time":"2013-01-01T18:20:00Z","text":"It crashes"},` +
+	`{"count":1,"creator":"bob","creation_time":"2013-01-02T08:00:00Z","text":"Fixed"}]}}}`
+
+//newServer serves bug 42, failing the first failures requests with status
+func newServer(status int, failures int32, retryAfter string) (*httptest.Server, *int32) {
+
+	requests := new(int32)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if atomic.AddInt32(requests, 1) <= failures {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(status)
+			w.Write([]byte(`{"error":true,"message":"try again"}`))
+			return
+		}
+
+		switch r.URL.Path {
+		case "/rest/bug/42":
+			w.Write([]byte(bugBody))
+		case "/rest/bug/42/comment":
+			w.Write([]byte(commentBody))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":true,"message":"Bug does not exist"}`))
+		}
+	}))
+
+	return server, requests
+}
+
+func TestFetch(t *testing.T) {
+
+	server, requests := newServer(http.StatusOK, 0, "")
+	defer server.Close()
+
+	linker := &RESTBugzillaLinker{BaseURL: server.URL, DatabaseName: "moz"}
+
+	report, err := linker.Fetch("bug 42")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attributes := report.Attributes()
+	if attributes.ExternalID != "moz_42" || attributes.Title != "Crash on start" ||
+		attributes.DateClosed != "2013-01-03T10:00:00Z" || attributes.Description != "It crashes" {
+		t.Errorf("unexpected report %+v", attributes)
+	}
+
+	if len(attributes.Comments) != 1 || attributes.Comments[0].Text != "Fixed" {
+		t.Errorf("unexpected comments %+v", attributes.Comments)
+	}
+
+	if *requests != 2 {
+		t.Errorf("%d requests, expected 2", *requests)
+	}
+}
+
+func TestFetchRetryAfter(t *testing.T) {
+
+	server, requests := newServer(http.StatusTooManyRequests, 1, "1")
+	defer server.Close()
+
+	linker := &RESTBugzillaLinker{BaseURL: server.URL, DatabaseName: "moz", Retries: 1, Backoff: time.Millisecond}
+
+	start := time.Now()
+	if _, err := linker.Fetch("#42"); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, expected the Retry-After of 1s", elapsed)
+	}
+
+	if *requests != 3 {
+		t.Errorf("%d requests, expected 3", *requests)
+	}
+}
+
+func TestFetchRetries(t *testing.T) {
+
+	tests := []struct {
+		status   int
+		retries  int
+		requests int32
+	}{
+		{http.StatusServiceUnavailable, 2, 3},
+		{http.StatusServiceUnavailable, 0, 1},
+		{http.StatusNotFound, 2, 1},
+	}
+
+	for _, test := range tests {
+
+		server, requests := newServer(test.status, 100, "")
+
+		linker := &RESTBugzillaLinker{BaseURL: server.URL, DatabaseName: "moz", Retries: test.retries, Backoff: time.Millisecond}
+
+		if _, err := linker.Fetch("42"); err == nil {
+			t.Errorf("status %d: expected an error", test.status)
+		}
+
+		if *requests != test.requests {
+			t.Errorf("status %d with %d retries: %d requests, expected %d", test.status, test.retries, *requests, test.requests)
+		}
+
+		server.Close()
+	}
+}
+
+func TestFetchArchive(t *testing.T) {
+
+	archive, err := ioutil.TempDir("", "bugzilla")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(archive)
+
+	server, requests := newServer(http.StatusOK, 0, "")
+
+	linker := &RESTBugzillaLinker{BaseURL: server.URL, ArchiveDir: archive, DatabaseName: "moz"}
+	if _, err = linker.Fetch("42"); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	if _, err = os.Stat(filepath.Join(archive, "bug", "42", "comment.json")); err != nil {
+		t.Error("the comments aren't archived:", err)
+	}
+
+	//Without url, the reports are read from the archive only
+	offline := &RESTBugzillaLinker{ArchiveDir: archive, DatabaseName: "moz"}
+
+	report, err := offline.Fetch("42")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Attributes().Title != "Crash on start" {
+		t.Errorf("unexpected report %+v", report.Attributes())
+	}
+
+	if _, err = offline.Fetch("43"); err == nil {
+		t.Error("expected an error for a bug missing from the archive")
+	}
+
+	if *requests != 2 {
+		t.Errorf("%d requests, expected 2", *requests)
+	}
+}
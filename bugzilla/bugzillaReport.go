@@ -1,72 +1,203 @@
 package bugzilla
 
 import (
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/mathieunls/deepchange-downloader/pogo"
 )
 
+//dateLayout is the layout of the dates of show_bug.cgi?ctype=xml
+const dateLayout = "2006-01-02 15:04:05 -0700"
+
 // BzReport represents a bugzilla bug
 type BzReport struct {
 	pogo.ReportAttributes
 	Comments []*Comment
 }
 
-// // New parses an XML file from a bugzilla system
-// func New(filePath string, url string) (*BzReport, error) {
-// 	r := BzReport{}
-// 	r.GenericReport = pogo.GenericReport{FilePath: filePath, Url: url}
-// 	r.DownloadFile()
-// 	r.ParseXML("bug", &r)
-// 	r.GenericReport.AllText = func() string {
-// 		return r.AllText(24.0)
-// 	}
-// 	r.GenericReport.ID = r.ID
-// 	r.GenericReport.Product = r.Product
-// 	return &r, nil
-// }
-
-// func (report BzReport) AllText(hours float64) string {
-
-// 	str := report.Title
-
-// 	dateReport, _ := time.Parse("2006-01-02 15:04:05 -0700", report.Date)
-
-// 	for index := 0; index < len(report.Comments); index++ {
-// 		dateComment, _ := time.Parse("2006-01-02 15:04:05 -0700", report.Comments[index].Date)
-
-// 		if dateComment.Sub(dateReport).Hours() < hours {
-// 			str += " " + report.Comments[index].Text
-// 		}
-
-// 	}
-
-// 	return str
-// }
-
-// func (report BzReport) String() string {
-// 	var str = "{ID=" + report.ID + "}\n" +
-// 		"{Date=" + report.Date + "}\n" +
-// 		"{Title=" + report.Title + "}\n" +
-// 		"{Product=" + report.Product + "}\n" +
-// 		"{Component=" + report.Component + "}\n" +
-// 		"{Version=" + report.Version + "}\n" +
-// 		"{Platform=" + report.Platform + "}\n" +
-// 		"{OS=" + report.OS + "}\n" +
-// 		"{Severity=" + report.Severity + "}\n" +
-// 		"{Reporter=" + report.Reporter + "}\n" +
-// 		"{Assignee=" + report.Assignee + "}\n"
-
-// 	for index := 0; index < len(report.Comments); index++ {
-
-// 		str += "\n{COMMENT={\n" +
-// 			"\t {Commenter=" + report.Comments[index].Commenter + "}\n" +
-// 			"\t {Order=" + strconv.Itoa(report.Comments[index].Order) + "}\n" +
-// 			"\t {Date=" + report.Comments[index].Date + "}\n" +
-// 			"\t {Text=" + report.Comments[index].Text + "}\n" +
-// 			"}\n"
-// 	}
-
-// 	return str
+//XMLBugzillaLinker links Bugzilla reports from a directory of
+//show_bug.cgi?ctype=xml documents named after the bugs, i.e. 1234.xml
+type XMLBugzillaLinker struct {
+	Dir          string
+	DatabaseName string
+}
+
+//bugzillaXML is a show_bug.cgi?ctype=xml document
+type bugzillaXML struct {
+	Bugs []bugXML `xml:"bug"`
+}
+
+type bugXML struct {
+	Error      string     `xml:"error,attr"`
+	ID         string     `xml:"bug_id"`
+	Created    string     `xml:"creation_ts"`
+	Changed    string     `xml:"delta_ts"`
+	Title      string     `xml:"short_desc"`
+	Status     string     `xml:"bug_status"`
+	Resolution string     `xml:"resolution"`
+	Product    string     `xml:"product"`
+	Component  string     `xml:"component"`
+	Version    string     `xml:"version"`
+	Severity   string     `xml:"bug_severity"`
+	Type       string     `xml:"bug_type"`
+	Reporter   string     `xml:"reporter"`
+	Assignee   string     `xml:"assigned_to"`
+	Comments   []*Comment `xml:"long_desc"`
+}
+
+//Fetch fetches a report from its XML document
+//It expects ids to look like bug 1234, #1234 or 1234
+func (linker *XMLBugzillaLinker) Fetch(id string) (pogo.Report, error) {
+
+	report, err := New(filepath.Join(linker.Dir, bugNumber(id)+".xml"), linker.DatabaseName)
+
+	return report, err
+}
+
+//DBName returns the name of the tracker, prefixing the reports
+func (linker *XMLBugzillaLinker) DBName() string {
+	return linker.DatabaseName
+}
+
+//Cached returns the report cached as attributes
+func (linker *XMLBugzillaLinker) Cached(attributes pogo.ReportAttributes) pogo.Report {
+	return &BzReport{ReportAttributes: attributes}
+}
+
+// New parses an XML file from a bugzilla system. The first comment of
+// a bug is its description, the resolution date is the one of its last
+// change once resolved
+func New(filePath string, databaseName string) (*BzReport, error) {
+
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	document := bugzillaXML{}
+	if err = xml.Unmarshal(content, &document); err != nil {
+		return nil, errors.New(filePath + ": " + err.Error())
+	}
+
+	if len(document.Bugs) == 0 {
+		return nil, errors.New(filePath + ": no bug")
+	}
+
+	bug := document.Bugs[0]
+	if bug.Error != "" {
+		return nil, errors.New(filePath + ": bug " + bug.Error)
+	}
+
+	r := BzReport{Comments: bug.Comments}
+	r.ExternalID = databaseName + "_" + bug.ID
+	r.Date = bug.Created
+	r.Type = bug.Type
+	r.Title = bug.Title
+	r.Product = bug.Product
+	r.Component = bug.Component
+	r.Version = bug.Version
+	r.Severity = bug.Severity
+	r.Resolution = bug.Resolution
+	r.Reporter = bug.Reporter
+	r.Assignee = bug.Assignee
+
+	if resolved(bug.Status) {
+		r.DateClosed = bug.Changed
+	}
+
+	for index, comment := range bug.Comments {
+
+		if index == 0 {
+			r.Description = comment.Text
+			continue
+		}
+
+		r.ReportAttributes.Comments = append(r.ReportAttributes.Comments, pogo.CommentAttribut{
+			Commenter: comment.Commenter,
+			Date:      comment.Date,
+			Text:      comment.Text})
+	}
+
+	return &r, nil
+}
+
+//Attributes returns the attributes of the report
+func (report *BzReport) Attributes() *pogo.ReportAttributes {
+	return &report.ReportAttributes
+}
+
+//AllText returns all the text from the report `hours` after openning
+func (report *BzReport) AllText(hours float64) string {
+
+	str := report.Title + " " + report.Description
+
+	dateReport := parseDate(report.Date)
+
+	for _, comment := range report.ReportAttributes.Comments {
+
+		dateComment := parseDate(comment.Date)
+
+		if dateComment.Sub(dateReport).Hours() < hours {
+			str += " " + comment.Text
+		}
+	}
+
+	return str
+}
+
+//bugNumber returns the number of the bug referenced
+//as bug 1234, #1234 or 1234, without leading zeros
+func bugNumber(id string) string {
+	return strings.TrimLeft(id[strings.LastIndexAny(id, " #-")+1:], "0")
+}
+
+//resolved returns whether a bug of status is resolved
+func resolved(status string) bool {
+	return status == "RESOLVED" || status == "VERIFIED" || status == "CLOSED"
+}
+
+//parseDate parses the dates of the XML documents and of the
+//REST API, i.e. 2013-01-01T18:20:00Z. It is zero when unknown
+func parseDate(date string) time.Time {
+
+	for _, layout := range []string{dateLayout, time.RFC3339} {
+		if parsed, err := time.Parse(layout, date); err == nil {
+			return parsed
+		}
+	}
+
+	return time.Time{}
+}
+
+//String returns a string representation
+func (report *BzReport) String() string {
+	var str = "{ExternalID=" + report.ExternalID + "}\n" +
+		"{Date=" + report.Date + "}\n" +
+		"{Title=" + report.Title + "}\n" +
+		"{Product=" + report.Product + "}\n" +
+		"{Component=" + report.Component + "}\n" +
+		"{Version=" + report.Version + "}\n" +
+		"{Severity=" + report.Severity + "}\n" +
+		"{Resolution=" + report.Resolution + "}\n" +
+		"{Reporter=" + report.Reporter + "}\n" +
+		"{Assignee=" + report.Assignee + "}\n" +
+		"{Description=" + report.Description + "}"
+
+	for index := 0; index < len(report.Comments); index++ {
+
+		str += "\n{COMMENT={\n" +
+			"\t {Commenter=" + report.Comments[index].Commenter + "}\n" +
+			"\t {Order=" + strconv.Itoa(report.Comments[index].Order) + "}\n" +
+			"\t {Date=" + report.Comments[index].Date + "}\n" +
+			"\t {Text=" + report.Comments[index].Text + "}\n" +
+			"}\n"
+	}
+
+	return str
 }
@@ -0,0 +1,344 @@
+package classifier
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+//Categories of the files
+const (
+	//CategorySource is the code of the project
+	CategorySource = "source"
+	//CategoryTest is the code testing the project
+	CategoryTest = "test"
+	//CategoryBuild builds, packages or deploys the project
+	CategoryBuild = "build"
+	//CategoryDocs documents the project
+	CategoryDocs = "docs"
+	//CategoryGenerated is generated or vendored, it isn't
+	//written by the developers of the project
+	CategoryGenerated = "generated"
+)
+
+//FileType is the language and the category of a file.
+//The language is empty for unknown files
+type FileType struct {
+	Language string
+	Category string
+}
+
+//IsCode returns whether the file is code written by the
+//developers of the project, i.e. source, test or build code
+func (fileType FileType) IsCode() bool {
+	return fileType.Language != "" &&
+		fileType.Category != CategoryDocs &&
+		fileType.Category != CategoryGenerated
+}
+
+//languages maps the extensions to their language. Extensions
+//of extentions.txt missing here are their own language
+var languages = map[string]string{
+	"c": "C", "h": "C",
+	"cc": "C++", "cpp": "C++", "cxx": "C++", "c++": "C++", "hh": "C++", "hpp": "C++", "hxx": "C++",
+	"m": "Objective-C", "mm": "Objective-C++",
+	"java": "Java", "groovy": "Groovy", "scala": "Scala", "kt": "Kotlin", "kts": "Kotlin",
+	"swift": "Swift", "dart": "Dart", "go": "Go", "rs": "Rust", "cs": "C#", "fs": "F#", "vb": "Visual Basic",
+	"js": "JavaScript", "jsx": "JavaScript", "mjs": "JavaScript", "cjs": "JavaScript",
+	"ts": "TypeScript", "tsx": "TypeScript", "coffee": "CoffeeScript",
+	"css": "CSS", "scss": "SCSS", "less": "Less", "html": "HTML", "htm": "HTML", "vue": "Vue",
+	"php": "PHP", "py": "Python", "pyx": "Cython", "rb": "Ruby", "pl": "Perl", "pm": "Perl",
+	"sh": "Shell", "bash": "Shell", "zsh": "Shell", "ksh": "Shell", "ps1": "PowerShell",
+	"r": "R", "lua": "Lua", "hs": "Haskell", "ml": "OCaml", "mli": "OCaml", "erl": "Erlang",
+	"ex": "Elixir", "exs": "Elixir", "clj": "Clojure", "el": "Emacs Lisp", "lisp": "Common Lisp",
+	"f90": "Fortran", "f": "Fortran", "jl": "Julia", "sql": "SQL", "proto": "Protocol Buffer",
+	"xml": "XML", "json": "JSON", "yml": "YAML", "yaml": "YAML", "toml": "TOML",
+	"mk": "Makefile", "mak": "Makefile", "cmake": "CMake", "gradle": "Gradle",
+	"bzl": "Starlark", "bazel": "Starlark", "dockerfile": "Dockerfile",
+	"md": "Markdown", "markdown": "Markdown", "rst": "reStructuredText",
+	"adoc": "AsciiDoc", "asciidoc": "AsciiDoc", "txt": "Text", "tex": "TeX",
+}
+
+//filenames maps the well-known files to their language
+var filenames = map[string]string{
+	"makefile": "Makefile", "gnumakefile": "Makefile",
+	"dockerfile": "Dockerfile", "containerfile": "Dockerfile",
+	"cmakelists.txt": "CMake", "build": "Starlark", "build.bazel": "Starlark", "workspace": "Starlark",
+	"pom.xml": "Maven POM", "build.xml": "Ant", "package.json": "JSON", "cargo.toml": "TOML", "go.mod": "Go Module",
+	"gemfile": "Ruby", "rakefile": "Ruby", "vagrantfile": "Ruby", "jenkinsfile": "Groovy",
+	"setup.py": "Python", "sconstruct": "Python", "meson.build": "Meson", "configure.ac": "M4",
+}
+
+//buildLanguages are the languages of build files only
+var buildLanguages = map[string]struct{}{
+	"Makefile": {}, "Dockerfile": {}, "CMake": {}, "Gradle": {}, "Starlark": {},
+	"Maven POM": {}, "Ant": {}, "Go Module": {}, "Meson": {}, "M4": {},
+}
+
+//docLanguages are the languages of documentation only
+var docLanguages = map[string]struct{}{
+	"Markdown": {}, "reStructuredText": {}, "AsciiDoc": {}, "Text": {}, "TeX": {},
+}
+
+//interpreters maps the interpreters of shebangs to their language
+var interpreters = map[string]string{
+	"sh": "Shell", "bash": "Shell", "zsh": "Shell", "ksh": "Shell", "dash": "Shell",
+	"python": "Python", "ruby": "Ruby", "perl": "Perl", "node": "JavaScript", "nodejs": "JavaScript",
+	"php": "PHP", "rscript": "R", "lua": "Lua", "groovy": "Groovy", "tclsh": "Tcl",
+}
+
+//docNames are the names, without extension, of documentation files
+var docNames = map[string]struct{}{
+	"readme": {}, "license": {}, "licence": {}, "copying": {}, "changelog": {}, "changes": {},
+	"news": {}, "authors": {}, "contributors": {}, "contributing": {}, "history": {},
+}
+
+//Paths of the files by category, following linguist
+var (
+	generatedPath = regexp.MustCompile(`(?i)(\.pb\.(go|cc|h)|_pb2(_grpc)?\.py|\.min\.(js|css)|` +
+		`\.designer\.cs|\.g\.cs|_generated\.go|\.generated\.\w+|(^|/)(package-lock\.json|yarn\.lock|` +
+		`cargo\.lock|gemfile\.lock|composer\.lock|go\.sum))$`)
+	vendoredPath = regexp.MustCompile(`(^|/)(vendor|vendors|node_modules|third_party|bower_components)/`)
+	docsPath     = regexp.MustCompile(`(?i)^docs?/|(^|/)documentation/`)
+	testPath     = regexp.MustCompile(`(^|/)(tests?|__tests__|specs?|testing|testdata|androidTest)/`)
+	testName     = regexp.MustCompile(`(_test\.\w+|^test_.*\.py|(^|\w)Tests?\.(java|kt|scala|groovy|cs|php|swift|m)|` +
+		`^Test\w*\.(java|kt|scala|groovy|cs|php)|\.(test|spec)\.\w+|_spec\.rb)$`)
+)
+
+//FileType returns the type of file, head being its first line, if
+//known, to read the shebang of scripts without extension. The
+//linguist attributes override the detection, they can be nil
+func (s *classifierSingleton) FileType(file string, head string, attributes *Attributes) FileType {
+
+	fileType := FileType{Language: s.language(file, head)}
+
+	override := attributes.lookup(file)
+	if language, present := override["linguist-language"]; present {
+		fileType.Language = language
+	}
+
+	generated := generatedPath.MatchString(file)
+	if value, present := override["linguist-generated"]; present {
+		generated = value == "true"
+	}
+
+	vendored := vendoredPath.MatchString(file)
+	if value, present := override["linguist-vendored"]; present {
+		vendored = value == "true"
+	}
+
+	//License.java or history.py are code, README or COPYING.LIB aren't
+	name := strings.ToLower(path.Base(file))
+	_, docName := docNames[strings.TrimSuffix(name, path.Ext(name))]
+	_, docLanguage := docLanguages[fileType.Language]
+	docs := (docName && fileType.Language == "") || docLanguage || docsPath.MatchString(file)
+	if value, present := override["linguist-documentation"]; present {
+		docs = value == "true"
+	}
+
+	_, build := buildLanguages[fileType.Language]
+	if language, present := filenames[name]; present && language == fileType.Language {
+		build = true
+	}
+
+	switch {
+	case generated || vendored:
+		fileType.Category = CategoryGenerated
+	case docs:
+		fileType.Category = CategoryDocs
+	case build:
+		fileType.Category = CategoryBuild
+	case testPath.MatchString(file) || testName.MatchString(path.Base(file)):
+		fileType.Category = CategoryTest
+	default:
+		fileType.Category = CategorySource
+	}
+
+	return fileType
+}
+
+//language detects the language of file by its shebang if it has no
+//extension, i.e. a scripts/build shell script, then by its name and its
+//final extension. It is empty when unknown
+func (s *classifierSingleton) language(file string, head string) string {
+
+	name := strings.ToLower(path.Base(file))
+
+	if path.Ext(name) == "" {
+		if language := shebang(head); language != "" {
+			return language
+		}
+	}
+
+	if language, present := filenames[name]; present {
+		return language
+	}
+
+	if strings.HasPrefix(name, "dockerfile.") {
+		return "Dockerfile"
+	}
+
+	if ext := strings.TrimPrefix(path.Ext(name), "."); ext != "" {
+
+		if language, present := languages[ext]; present {
+			return language
+		}
+
+		if s.IsCodeExtention(ext) {
+			return ext
+		}
+	}
+
+	return ""
+}
+
+//shebang returns the language of the interpreter of a
+//#!/usr/bin/env python3 like line, empty if there is none
+func shebang(head string) string {
+
+	if !strings.HasPrefix(head, "#!") {
+		return ""
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(head, "#!"))
+	if len(fields) == 0 {
+		return ""
+	}
+
+	interpreter := path.Base(fields[0])
+
+	//env looks up the interpreter, skipping its options
+	if interpreter == "env" {
+		interpreter = ""
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "-") && !strings.Contains(field, "=") {
+				interpreter = path.Base(field)
+				break
+			}
+		}
+	}
+
+	//python3.8 is python
+	interpreter = strings.TrimRight(strings.ToLower(interpreter), "0123456789.")
+
+	return interpreters[interpreter]
+}
+
+//unspecified is the value of the attributes reset by !attribute,
+//back to their detection
+const unspecified = "!"
+
+//Attributes are the linguist attributes of a .gitattributes file:
+//linguist-language, linguist-generated, linguist-vendored and
+//linguist-documentation
+type Attributes struct {
+	rules []attributeRule
+}
+
+type attributeRule struct {
+	pattern *regexp.Regexp
+	values  map[string]string
+}
+
+//ParseAttributes parses the linguist attributes of the content of a
+//.gitattributes file. Other attributes and macros are ignored
+func ParseAttributes(content string) *Attributes {
+
+	attributes := &Attributes{}
+
+	for _, line := range strings.Split(content, "\n") {
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "[") {
+			continue
+		}
+
+		values := make(map[string]string)
+
+		for _, attribute := range fields[1:] {
+
+			set := "true"
+			if strings.HasPrefix(attribute, "-") {
+				attribute, set = attribute[1:], "false"
+			} else if strings.HasPrefix(attribute, "!") {
+				attribute, set = attribute[1:], unspecified
+			}
+
+			if !strings.HasPrefix(attribute, "linguist-") {
+				continue
+			}
+
+			if i := strings.Index(attribute, "="); i != -1 {
+				attribute, set = attribute[:i], attribute[i+1:]
+			}
+
+			values[attribute] = set
+		}
+
+		if len(values) > 0 {
+			attributes.rules = append(attributes.rules, attributeRule{attributePattern(fields[0]), values})
+		}
+	}
+
+	return attributes
+}
+
+//lookup returns the attributes of file, the last matching
+//rule winning as with git. Unspecified attributes are left out
+func (attributes *Attributes) lookup(file string) map[string]string {
+
+	values := make(map[string]string)
+
+	if attributes == nil {
+		return values
+	}
+
+	for _, rule := range attributes.rules {
+		if rule.pattern.MatchString(file) {
+			for attribute, value := range rule.values {
+				if value == unspecified {
+					delete(values, attribute)
+				} else {
+					values[attribute] = value
+				}
+			}
+		}
+	}
+
+	return values
+}
+
+//attributePattern compiles a gitattributes pattern. Patterns without
+//a slash match the file name at any depth, others the path from the
+//root. Directories, ending with a slash, match the files they contain
+func attributePattern(pattern string) *regexp.Regexp {
+
+	expression := "^"
+	if !strings.Contains(strings.TrimSuffix(pattern, "/"), "/") {
+		expression += "(.*/)?"
+	}
+
+	pattern = strings.TrimPrefix(pattern, "/")
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expression += "(.*/)?"
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expression += ".*"
+			i++
+		case pattern[i] == '*':
+			expression += "[^/]*"
+		case pattern[i] == '?':
+			expression += "[^/]"
+		default:
+			expression += regexp.QuoteMeta(pattern[i : i+1])
+		}
+	}
+
+	return regexp.MustCompile(expression + "$")
+}
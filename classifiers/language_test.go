@@ -0,0 +1,70 @@
+package classifier
+
+import "testing"
+
+func TestFileType(t *testing.T) {
+
+	s := &classifierSingleton{codeExtentions: map[string]struct{}{}}
+
+	attributes := ParseAttributes("third/ linguist-vendored\n" +
+		"*.gen.go linguist-generated\n" +
+		"keep.gen.go !linguist-generated\n" +
+		"*.inc -linguist-documentation linguist-language=C\n")
+
+	tests := []struct {
+		file     string
+		head     string
+		expected FileType
+	}{
+		{"src/License.java", "", FileType{"Java", CategorySource}},
+		{"lib/history.py", "", FileType{"Python", CategorySource}},
+		{"lib/Changes.pm", "", FileType{"Perl", CategorySource}},
+		{"src/Contributors.java", "", FileType{"Java", CategorySource}},
+		{"LICENSE", "", FileType{"", CategoryDocs}},
+		{"COPYING.LIB", "", FileType{"", CategoryDocs}},
+		{"README.md", "", FileType{"Markdown", CategoryDocs}},
+		{"docs/conf.py", "", FileType{"Python", CategoryDocs}},
+		{"src/go/doc/comment.go", "", FileType{"Go", CategorySource}},
+		{"api/documentation/index.js", "", FileType{"JavaScript", CategoryDocs}},
+		{"scripts/build", "#!/bin/sh", FileType{"Shell", CategorySource}},
+		{"BUILD", "", FileType{"Starlark", CategoryBuild}},
+		{"Makefile", "#!/usr/bin/make -f", FileType{"Makefile", CategoryBuild}},
+		{"src/main_test.go", "", FileType{"Go", CategoryTest}},
+		{"third/lib/a.c", "", FileType{"C", CategoryGenerated}},
+		{"a/third/lib/a.c", "", FileType{"C", CategoryGenerated}},
+		{"third.c", "", FileType{"C", CategorySource}},
+		{"api/types.gen.go", "", FileType{"Go", CategoryGenerated}},
+		{"api/keep.gen.go", "", FileType{"Go", CategorySource}},
+		{"docs/table.inc", "", FileType{"C", CategorySource}},
+	}
+
+	for _, test := range tests {
+		if actual := s.FileType(test.file, test.head, attributes); actual != test.expected {
+			t.Errorf("FileType(%q) = %v, expected %v", test.file, actual, test.expected)
+		}
+	}
+}
+
+func TestAttributePattern(t *testing.T) {
+
+	tests := []struct {
+		pattern string
+		file    string
+		matches bool
+	}{
+		{"vendor/", "vendor/a.go", true},
+		{"vendor/", "src/vendor/b/a.go", true},
+		{"vendor/", "vendor.go", false},
+		{"/vendor/", "src/vendor/a.go", false},
+		{"docs/*.md", "docs/a.md", true},
+		{"docs/*.md", "src/docs/a.md", false},
+		{"**/gen/*", "a/b/gen/c.go", true},
+		{"*.pb.go", "api/v1/a.pb.go", true},
+	}
+
+	for _, test := range tests {
+		if actual := attributePattern(test.pattern).MatchString(test.file); actual != test.matches {
+			t.Errorf("attributePattern(%q) matches %q = %v, expected %v", test.pattern, test.file, actual, test.matches)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package classifier
+
+import "strings"
+
+//Syntax describes how a language writes comments, strings and imports
+type Syntax struct {
+	LineComments []string
+	BlockStart   string
+	BlockEnd     string
+	//Prefix of the lines continuing a block comment, i.e. * in javadoc
+	BlockContinuation string
+	//Characters opening and closing the string literals, i.e. "'
+	Quotes  string
+	Imports []string
+}
+
+//cStyle returns the syntax of a language commented like C
+func cStyle(quotes string, imports ...string) *Syntax {
+	return &Syntax{[]string{"//"}, "/*", "*/", "*", quotes, imports}
+}
+
+//hashStyle returns the syntax of a language commented like shell
+func hashStyle(quotes string, imports ...string) *Syntax {
+	return &Syntax{[]string{"#"}, "", "", "", quotes, imports}
+}
+
+//syntaxes maps the languages detected by FileType to their syntax.
+//Languages missing here have no known comments nor imports
+var syntaxes = map[string]*Syntax{
+	"C":             cStyle(`"'`, "#include"),
+	"C++":           cStyle(`"'`, "#include"),
+	"Objective-C":   cStyle(`"'`, "#import", "#include", "@import "),
+	"Objective-C++": cStyle(`"'`, "#import", "#include", "@import "),
+	"Java":          cStyle(`"'`, "import "),
+	"Groovy":        cStyle(`"'`, "import "),
+	"Gradle":        cStyle(`"'`, "import "),
+	"Scala":         cStyle(`"'`, "import "),
+	"Kotlin":        cStyle(`"'`, "import "),
+	"Swift":         cStyle(`"`, "import "),
+	"Dart":          cStyle(`"'`, "import "),
+	"Go":            cStyle("\"'`", "import "),
+	"JavaScript":    cStyle("\"'`", "import "),
+	"TypeScript":    cStyle("\"'`", "import "),
+	"C#":            cStyle(`"'`, "using "),
+	"Rust":          cStyle(`"`, "use ", "extern crate "),
+	"SCSS":          cStyle(`"'`, "@import "),
+	"Less":          cStyle(`"'`, "@import "),
+	"CSS":           {nil, "/*", "*/", "*", `"'`, []string{"@import "}},
+	"PHP":           {[]string{"//", "#"}, "/*", "*/", "*", `"'`, []string{"use ", "require", "include"}},
+	"Python":        {[]string{"#"}, `"""`, `"""`, "", `"'`, []string{"import ", "from "}},
+	"Cython":        {[]string{"#"}, `"""`, `"""`, "", `"'`, []string{"import ", "from ", "cimport "}},
+	"Starlark":      {[]string{"#"}, `"""`, `"""`, "", `"'`, []string{"load("}},
+	"Ruby":          {[]string{"#"}, "=begin", "=end", "", `"'`, []string{"require ", "require_relative "}},
+	"Perl":          hashStyle(`"'`, "use ", "require "),
+	"Shell":         hashStyle(`"'`, "source ", ". "),
+	"R":             hashStyle(`"'`, "library(", "require("),
+	"CMake":         hashStyle(`"`, "include("),
+	"Makefile":      hashStyle("", "include "),
+	"Dockerfile":    hashStyle(""),
+	"YAML":          hashStyle(`"'`),
+	"TOML":          hashStyle(`"'`),
+	"Elixir":        hashStyle(`"'`, "import ", "alias ", "require ", "use "),
+	"Julia":         hashStyle(`"`, "using ", "import "),
+	"CoffeeScript":  {[]string{"#"}, "###", "###", "", `"'`, []string{"import "}},
+	"PowerShell":    {[]string{"#"}, "<#", "#>", "", `"'`, []string{"Import-Module "}},
+	"SQL":           {[]string{"--"}, "/*", "*/", "*", `"'`, nil},
+	"Lua":           {[]string{"--"}, "--[[", "]]", "", `"'`, []string{"require"}},
+	"Haskell":       {[]string{"--"}, "{-", "-}", "", `"`, []string{"import "}},
+	"OCaml":         {nil, "(*", "*)", "", `"`, []string{"open "}},
+	"Erlang":        {[]string{"%"}, "", "", "", `"'`, []string{"-include"}},
+	"Clojure":       {[]string{";"}, "", "", "", `"`, []string{"(require ", "(:require "}},
+	"Emacs Lisp":    {[]string{";"}, "", "", "", `"`, []string{"(require "}},
+	"Common Lisp":   {[]string{";"}, "#|", "|#", "", `"`, []string{"(require "}},
+	"Fortran":       {[]string{"!"}, "", "", "", `"'`, []string{"use "}},
+	"Visual Basic":  {[]string{"'"}, "", "", "", `"`, []string{"Imports "}},
+	"HTML":          {nil, "<!--", "-->", "", "", nil},
+	"XML":           {nil, "<!--", "-->", "", "", nil},
+	"Maven POM":     {nil, "<!--", "-->", "", "", nil},
+	"Ant":           {nil, "<!--", "-->", "", "", nil},
+}
+
+//Syntax returns the syntax of language, as detected
+//by FileType, nil when it isn't known
+func (s *classifierSingleton) Syntax(language string) *Syntax {
+	return syntaxes[language]
+}
+
+//Code returns line without its comments and whether a block comment is
+//still open at its end, inBlock telling if one was open at its start.
+//Comment markers inside string literals, escaped quotes included, are code
+func (syntax *Syntax) Code(line string, inBlock bool) (string, bool) {
+
+	code := ""
+
+	//Without the start of a block comment, its continuation
+	//and its end are recognized by the start of the lines
+	if trimmed := strings.TrimSpace(line); !inBlock && syntax.BlockStart != "" {
+
+		if syntax.BlockContinuation != "" && (trimmed == syntax.BlockContinuation ||
+			strings.HasPrefix(trimmed, syntax.BlockContinuation+" ")) {
+			return "", false
+		}
+
+		if syntax.BlockEnd != syntax.BlockStart && strings.HasPrefix(trimmed, syntax.BlockEnd) {
+			inBlock = true
+		}
+	}
+
+	for line != "" {
+
+		if inBlock {
+			end := strings.Index(line, syntax.BlockEnd)
+			if end == -1 {
+				return code, true
+			}
+			line = line[end+len(syntax.BlockEnd):]
+			inBlock = false
+			continue
+		}
+
+		//The first comment starting outside a string wins,
+		//a block comment over a line comment starting with it
+		start, block := syntax.commentStart(line)
+
+		if start == -1 {
+			return code + line, false
+		}
+
+		code += line[:start]
+
+		if !block {
+			return code, false
+		}
+
+		line = line[start+len(syntax.BlockStart):]
+		inBlock = true
+	}
+
+	return code, inBlock
+}
+
+//commentStart returns the index of the first comment of line starting
+//outside a string literal, -1 if there is none, and whether it is a block
+//comment. Strings left open at the end of the line are closed there
+func (syntax *Syntax) commentStart(line string) (int, bool) {
+
+	var quote byte
+
+	for i := 0; i < len(line); i++ {
+
+		if quote != 0 {
+			if line[i] == '\\' {
+				i++
+			} else if line[i] == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		if syntax.BlockStart != "" && strings.HasPrefix(line[i:], syntax.BlockStart) {
+			return i, true
+		}
+
+		for _, marker := range syntax.LineComments {
+			if strings.HasPrefix(line[i:], marker) {
+				return i, false
+			}
+		}
+
+		if strings.IndexByte(syntax.Quotes, line[i]) != -1 {
+			quote = line[i]
+		}
+	}
+
+	return -1, false
+}
+
+//IsImport returns whether the code of a line imports a module
+func (syntax *Syntax) IsImport(code string) bool {
+
+	code = strings.TrimSpace(code)
+
+	for _, prefix := range syntax.Imports {
+		if strings.HasPrefix(code, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
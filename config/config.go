@@ -0,0 +1,386 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mathieunls/deepchange-downloader/git"
+	"github.com/mathieunls/deepchange-downloader/pogo"
+)
+
+//Tracker types supported by a study
+const (
+	TrackerNone         = ""
+	TrackerJiraMySQL    = "jira-mysql"
+	TrackerBugzillaXML  = "bugzilla-xml"
+	TrackerBugzillaREST = "bugzilla-rest"
+)
+
+//Output types supported by a study
+const (
+	OutputMySQL      = "mysql"
+	OutputCSV        = "csv"
+	OutputGraphML    = "graphml"
+	OutputDOT        = "dot"
+	OutputJSONLines  = "jsonl"
+	OutputSuspicious = "suspicious-csv"
+)
+
+//Study describes one study: the repositories to mine, the tracker
+//holding their reports and where the results are written
+type Study struct {
+	Repositories        []Repository `json:"repositories"`
+	Tracker             Tracker      `json:"tracker"`
+	FixPatterns         []string     `json:"fix_patterns"`
+	FixConventions      []string     `json:"fix_conventions"`
+	ReviewerPatterns    []string     `json:"reviewer_patterns"`
+	ReviewerConventions []string     `json:"reviewer_conventions"`
+	P4                  *bool        `json:"p4"`
+	Threads             int          `json:"threads"`
+	EntropyWindowDays   int          `json:"entropy_window_days"`
+	ChangeWindowDays    int          `json:"change_window_days"`
+	SZZ                 string       `json:"szz"`
+	ExcludeTests        bool         `json:"exclude_tests"`
+	MergePolicy         string       `json:"merge_policy"`
+	FirstParent         bool         `json:"first_parent"`
+	AllRefs             bool         `json:"all_refs"`
+	AliasFile           string       `json:"alias_file"`
+	TimeFilter          string       `json:"time_filter"`
+	LinkTimeoutMinutes  *int         `json:"link_timeout_minutes"`
+	Blame               Blame        `json:"blame"`
+	Outputs             []Output     `json:"outputs"`
+}
+
+//Repository locates a git repository to mine
+type Repository struct {
+	ID                 int    `json:"id"`
+	Name               string `json:"name"`
+	Dir                string `json:"dir"`
+	WorkingDir         string `json:"working_dir"`
+	LogDir             string `json:"log_dir"`
+	LastIngestedCommit string `json:"last_ingested_commit"`
+}
+
+//Tracker describes how to reach the reports fixed by the commits
+type Tracker struct {
+	Type              string  `json:"type"`
+	DSN               string  `json:"dsn"`
+	ProjectKey        string  `json:"project_key"`
+	DatabaseName      string  `json:"database_name"`
+	Dir               string  `json:"dir"`
+	URL               string  `json:"url"`
+	APIKey            string  `json:"api_key"`
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	Retries           *int    `json:"retries"`
+	BackoffSeconds    int     `json:"backoff_seconds"`
+}
+
+//Blame describes how the lines of the fixes are traced back
+//to the commits introducing them
+type Blame struct {
+	DetectMoves      bool     `json:"detect_moves"`
+	DetectCopies     bool     `json:"detect_copies"`
+	IgnoreWhitespace bool     `json:"ignore_whitespace"`
+	IgnoreRevs       []string `json:"ignore_revs"`
+	IgnoreRevsFile   string   `json:"ignore_revs_file"`
+}
+
+//Output describes a sink for the mined data
+type Output struct {
+	Type     string `json:"type"`
+	DSN      string `json:"dsn"`
+	Database string `json:"database"`
+	Gram     int    `json:"gram"`
+	Path     string `json:"path"`
+}
+
+//Load reads, completes and validates the study described by
+//the JSON file at path
+func Load(path string) (*Study, error) {
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	study := &Study{}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(study); err != nil {
+		return nil, errors.New(path + ": " + err.Error())
+	}
+
+	study.SetDefaults()
+
+	if err = study.Validate(); err != nil {
+		return nil, errors.New(path + ": " + err.Error())
+	}
+
+	return study, nil
+}
+
+//SetDefaults fills the optional fields left empty
+func (study *Study) SetDefaults() {
+
+	if study.Threads == 0 {
+		study.Threads = 12
+	}
+
+	if study.ChangeWindowDays == 0 {
+		study.ChangeWindowDays = 365
+	}
+
+	//Same default as the -p4 flag
+	if study.P4 == nil {
+		p4 := true
+		study.P4 = &p4
+	}
+
+	if study.SZZ == "" {
+		study.SZZ = git.SZZOriginal
+	}
+
+	if study.TimeFilter == "" {
+		study.TimeFilter = git.TimeFilterOff
+	}
+
+	if study.MergePolicy == "" {
+		study.MergePolicy = git.MergeSkip
+	}
+
+	//Zero leaves the linking unbounded
+	if study.LinkTimeoutMinutes == nil {
+		minutes := 60
+		study.LinkTimeoutMinutes = &minutes
+	}
+
+	if tracker := &study.Tracker; tracker.Type == TrackerBugzillaREST {
+
+		//Keeps the key out of the study files
+		if tracker.APIKey == "" {
+			tracker.APIKey = os.Getenv("BUGZILLA_API_KEY")
+		}
+
+		if tracker.RequestsPerSecond == 0 {
+			tracker.RequestsPerSecond = 1
+		}
+
+		//Zero disables the retries
+		if tracker.Retries == nil {
+			retries := 3
+			tracker.Retries = &retries
+		}
+
+		if tracker.BackoffSeconds == 0 {
+			tracker.BackoffSeconds = 1
+		}
+	}
+
+	for i := range study.Repositories {
+		repo := &study.Repositories[i]
+
+		if repo.WorkingDir == "" {
+			repo.WorkingDir = repo.Dir
+		}
+
+		if repo.LogDir == "" {
+			repo.LogDir = repo.WorkingDir + "cache/" + repo.Name + "/"
+		}
+	}
+
+	for i := range study.Outputs {
+		output := &study.Outputs[i]
+
+		if output.Type == OutputMySQL && output.Gram == 0 {
+			output.Gram = 1
+		}
+
+		if output.Type == OutputMySQL && output.Database == "" {
+			output.Database = "bumper"
+		}
+	}
+}
+
+//Validate returns the first inconsistency found in the study
+func (study *Study) Validate() error {
+
+	if len(study.Repositories) == 0 {
+		return errors.New("at least one repository is required")
+	}
+
+	ids := make(map[int]struct{})
+
+	for i, repo := range study.Repositories {
+
+		where := "repositories[" + strconv.Itoa(i) + "]"
+
+		if repo.Name == "" || repo.Dir == "" {
+			return errors.New(where + ": name and dir are required")
+		}
+
+		for _, dir := range []string{repo.Dir, repo.WorkingDir, repo.LogDir} {
+			if !strings.HasSuffix(dir, "/") {
+				return errors.New(where + ": " + dir + " must end with /")
+			}
+		}
+
+		if _, present := ids[repo.ID]; present {
+			return errors.New(where + ": duplicated id " + strconv.Itoa(repo.ID))
+		}
+		ids[repo.ID] = struct{}{}
+	}
+
+	if _, err := study.FixExtractor(); err != nil {
+		return errors.New("fix: " + err.Error())
+	}
+
+	if _, err := study.ReviewerExtractor(); err != nil {
+		return errors.New("reviewer: " + err.Error())
+	}
+
+	if study.Threads < 1 {
+		return errors.New("threads must be positive")
+	}
+
+	if study.LinkTimeoutMinutes != nil && *study.LinkTimeoutMinutes < 0 {
+		return errors.New("link_timeout_minutes can't be negative")
+	}
+
+	if study.EntropyWindowDays < 0 {
+		return errors.New("entropy_window_days can't be negative")
+	}
+
+	if study.ChangeWindowDays < 0 {
+		return errors.New("change_window_days can't be negative")
+	}
+
+	if !contains(git.SZZVariants, study.SZZ) {
+		return errors.New("szz: unknown variant " + study.SZZ + ", expected one of " + strings.Join(git.SZZVariants, ", "))
+	}
+
+	if !contains(git.TimeFilters, study.TimeFilter) {
+		return errors.New("time_filter: unknown mode " + study.TimeFilter + ", expected one of " + strings.Join(git.TimeFilters, ", "))
+	}
+
+	if study.AliasFile != "" {
+		if _, err := os.Stat(study.AliasFile); err != nil {
+			return errors.New("alias_file: " + err.Error())
+		}
+	}
+
+	if !contains(git.MergePolicies, study.MergePolicy) {
+		return errors.New("merge_policy: unknown policy " + study.MergePolicy + ", expected one of " + strings.Join(git.MergePolicies, ", "))
+	}
+
+	if study.Blame.IgnoreRevsFile != "" {
+		if _, err := os.Stat(study.Blame.IgnoreRevsFile); err != nil {
+			return errors.New("blame: " + err.Error())
+		}
+	}
+
+	switch study.Tracker.Type {
+	case TrackerNone:
+	case TrackerJiraMySQL:
+		if study.Tracker.DSN == "" || study.Tracker.ProjectKey == "" || study.Tracker.DatabaseName == "" {
+			return errors.New("tracker: dsn, project_key and database_name are required for " + TrackerJiraMySQL)
+		}
+	case TrackerBugzillaXML:
+		if study.Tracker.Dir == "" || study.Tracker.DatabaseName == "" {
+			return errors.New("tracker: dir and database_name are required for " + TrackerBugzillaXML)
+		}
+		if _, err := os.Stat(study.Tracker.Dir); err != nil {
+			return errors.New("tracker: " + err.Error())
+		}
+	case TrackerBugzillaREST:
+		if (study.Tracker.URL == "" && study.Tracker.Dir == "") || study.Tracker.DatabaseName == "" {
+			return errors.New("tracker: url or dir, and database_name are required for " + TrackerBugzillaREST)
+		}
+		if study.Tracker.URL != "" && !strings.HasPrefix(study.Tracker.URL, "http://") && !strings.HasPrefix(study.Tracker.URL, "https://") {
+			return errors.New("tracker: url must be an http or https url, i.e. https://bugzilla.mozilla.org")
+		}
+		//Without url, the reports are read from the archive only
+		if study.Tracker.URL == "" {
+			if _, err := os.Stat(study.Tracker.Dir); err != nil {
+				return errors.New("tracker: " + err.Error())
+			}
+		}
+		if study.Tracker.RequestsPerSecond < 0 || (study.Tracker.Retries != nil && *study.Tracker.Retries < 0) || study.Tracker.BackoffSeconds < 0 {
+			return errors.New("tracker: requests_per_second, retries and backoff_seconds can't be negative")
+		}
+	default:
+		return errors.New("tracker: unknown type " + study.Tracker.Type)
+	}
+
+	for i, output := range study.Outputs {
+
+		where := "outputs[" + strconv.Itoa(i) + "]"
+
+		switch output.Type {
+		case OutputMySQL:
+			if output.DSN == "" {
+				return errors.New(where + ": dsn is required for " + OutputMySQL)
+			}
+		case OutputCSV, OutputGraphML, OutputDOT, OutputJSONLines, OutputSuspicious:
+			if output.Path == "" {
+				return errors.New(where + ": path is required for " + output.Type)
+			}
+		default:
+			return errors.New(where + ": unknown type " + output.Type)
+		}
+	}
+
+	return nil
+}
+
+//Output returns the first output of the given type, if any
+func (study *Study) Output(outputType string) *Output {
+
+	for i := range study.Outputs {
+		if study.Outputs[i].Type == outputType {
+			return &study.Outputs[i]
+		}
+	}
+
+	return nil
+}
+
+//FixExtractor returns the extractor of fixed report ids made of the
+//fix conventions and patterns, nil if the study doesn't define any
+func (study *Study) FixExtractor() (pogo.ReferenceExtractor, error) {
+
+	patterns, err := pogo.ConventionPatterns(study.FixConventions, study.Tracker.ProjectKey)
+	if err != nil || len(patterns)+len(study.FixPatterns) == 0 {
+		return nil, err
+	}
+
+	return pogo.NewFixExtractor(append(patterns, study.FixPatterns...)...)
+}
+
+//ReviewerExtractor returns the extractor of reviewers made of the reviewer
+//conventions and patterns, nil if the study doesn't define any
+func (study *Study) ReviewerExtractor() (pogo.ReferenceExtractor, error) {
+
+	patterns, err := pogo.ConventionPatterns(study.ReviewerConventions, "")
+	if err != nil || len(patterns)+len(study.ReviewerPatterns) == 0 {
+		return nil, err
+	}
+
+	return pogo.NewReviewerExtractor(append(patterns, study.ReviewerPatterns...)...)
+}
+
+func contains(values []string, value string) bool {
+
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,24 @@
+package config
+
+import "testing"
+
+func TestLoadExample(t *testing.T) {
+
+	study, err := Load("study.example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(study.Repositories) != 1 || study.Repositories[0].Name != "hbase" {
+		t.Errorf("unexpected repositories %+v", study.Repositories)
+	}
+
+	if *study.P4 || *study.LinkTimeoutMinutes != 60 || study.ChangeWindowDays != 365 {
+		t.Errorf("unexpected p4 %v, link_timeout_minutes %d or change_window_days %d",
+			*study.P4, *study.LinkTimeoutMinutes, study.ChangeWindowDays)
+	}
+
+	if study.Output(OutputCSV) == nil {
+		t.Error("the csv output is missing")
+	}
+}
@@ -0,0 +1,67 @@
+package exporter
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+//WriteDOT writes the graph in the Graphviz DOT language, edges going
+//from the bug-introducing commits to their fixes. Fixing commits are
+//boxes, commits both fixing and introducing bugs are red boxes
+func (graph *Graph) WriteDOT(w io.Writer) error {
+
+	out := bufio.NewWriter(w)
+
+	out.WriteString("digraph fixes {\n")
+	out.WriteString("\tnode [shape=ellipse];\n")
+
+	for _, node := range graph.Nodes {
+
+		attributes := []string{"label=" + quote(shortHash(node.Hash))}
+
+		if node.AuthorEmail != "" {
+			attributes = append(attributes, "tooltip="+quote(node.AuthorEmail))
+		}
+
+		if node.Fixing {
+			attributes = append(attributes, "shape=box")
+		}
+
+		if node.Fixing && node.Buggy {
+			attributes = append(attributes, "color=red")
+		}
+
+		out.WriteString("\t" + quote(nodeID(node.RepositoryID, node.Hash)) + " [" + strings.Join(attributes, ", ") + "];\n")
+	}
+
+	for _, edge := range graph.Edges {
+
+		out.WriteString("\t" + quote(nodeID(edge.RepositoryID, edge.Introducer)) + " -> " + quote(nodeID(edge.RepositoryID, edge.Fix)))
+
+		if len(edge.ReportIDs) > 0 {
+			out.WriteString(" [label=" + quote(strings.Join(edge.ReportIDs, " ")) + "]")
+		}
+
+		out.WriteString(";\n")
+	}
+
+	out.WriteString("}\n")
+
+	return out.Flush()
+}
+
+//quote quotes value as a DOT string, where only the double quotes
+//and the backslashes are escaped, the other characters are kept as is
+func quote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+func shortHash(hash string) string {
+
+	if len(hash) > 10 {
+		return hash[:10]
+	}
+
+	return hash
+}
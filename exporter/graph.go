@@ -0,0 +1,132 @@
+package exporter
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/mathieunls/deepchange-downloader/pogo"
+)
+
+//Node is a commit taking part in at least one fix
+type Node struct {
+	Hash         string `json:"hash"`
+	RepositoryID int    `json:"repository_id"`
+	AuthorEmail  string `json:"author_email,omitempty"`
+	Timestamp    int    `json:"timestamp,omitempty"`
+	Buggy        bool   `json:"buggy"`
+	Fixing       bool   `json:"fixing"`
+}
+
+//Edge links a bug-introducing commit to the commit fixing it
+type Edge struct {
+	RepositoryID int           `json:"repository_id"`
+	Introducer   string        `json:"introducer"`
+	Fix          string        `json:"fix"`
+	ReportIDs    []string      `json:"report_ids"`
+	Provenance   []*Provenance `json:"provenance"`
+}
+
+//Provenance is a line of the fix blamed on the bug-introducing commit.
+//File and Line locate it in the parent of the fix, OriginalFile and
+//OriginalLine in the bug-introducing commit
+type Provenance struct {
+	File         string `json:"file"`
+	Line         int    `json:"line"`
+	OriginalFile string `json:"original_file"`
+	OriginalLine int    `json:"original_line"`
+	Content      string `json:"content"`
+	SZZ          string `json:"szz"`
+}
+
+//Graph is the graph of the bug-introducing and bug-fixing commits
+type Graph struct {
+	Nodes []*Node
+	Edges []*Edge
+}
+
+//NewGraph builds the graph of the links found by LinkCorrectiveCommits
+//between the commits. Fixes that aren't part of commits, i.e. ingested
+//by a previous run, are nodes without author nor timestamp
+func NewGraph(commits []*pogo.Commit) *Graph {
+
+	graph := &Graph{}
+	byHash := make(map[string]*pogo.Commit)
+	nodes := make(map[string]*Node)
+
+	//Commits are told apart by their repository as well, forks share hashes
+	for _, commit := range commits {
+		byHash[nodeID(commit.RepositoryID, commit.CommitHash)] = commit
+	}
+
+	node := func(hash string, repositoryID int) *Node {
+
+		id := nodeID(repositoryID, hash)
+
+		if _, present := nodes[id]; !present {
+
+			nodes[id] = &Node{Hash: hash, RepositoryID: repositoryID}
+
+			if commit, present := byHash[id]; present {
+				nodes[id].AuthorEmail = commit.AuthorEmail
+				nodes[id].Timestamp = commit.AuthorDateUnixTimestamp
+			}
+
+			graph.Nodes = append(graph.Nodes, nodes[id])
+		}
+
+		return nodes[id]
+	}
+
+	for _, commit := range commits {
+
+		for _, fixHash := range commit.FixHashes {
+
+			node(commit.CommitHash, commit.RepositoryID).Buggy = true
+			node(fixHash, commit.RepositoryID).Fixing = true
+
+			edge := &Edge{RepositoryID: commit.RepositoryID, Introducer: commit.CommitHash, Fix: fixHash, ReportIDs: []string{}, Provenance: []*Provenance{}}
+			if fix, present := byHash[nodeID(commit.RepositoryID, fixHash)]; present && fix.FixReportIDs != nil {
+				edge.ReportIDs = fix.FixReportIDs
+			}
+
+			for _, provenance := range commit.FixProvenances {
+				if provenance.FixHash == fixHash {
+					edge.Provenance = append(edge.Provenance, &Provenance{
+						File:         provenance.File,
+						Line:         provenance.Line,
+						OriginalFile: provenance.OriginalFile,
+						OriginalLine: provenance.OriginalLine,
+						Content:      provenance.Content,
+						SZZ:          provenance.SZZ,
+					})
+				}
+			}
+
+			graph.Edges = append(graph.Edges, edge)
+		}
+	}
+
+	//Stable outputs regardless of the order of the commits
+	sort.Slice(graph.Nodes, func(i, j int) bool {
+		if graph.Nodes[i].RepositoryID != graph.Nodes[j].RepositoryID {
+			return graph.Nodes[i].RepositoryID < graph.Nodes[j].RepositoryID
+		}
+		return graph.Nodes[i].Hash < graph.Nodes[j].Hash
+	})
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].RepositoryID != graph.Edges[j].RepositoryID {
+			return graph.Edges[i].RepositoryID < graph.Edges[j].RepositoryID
+		}
+		if graph.Edges[i].Introducer != graph.Edges[j].Introducer {
+			return graph.Edges[i].Introducer < graph.Edges[j].Introducer
+		}
+		return graph.Edges[i].Fix < graph.Edges[j].Fix
+	})
+
+	return graph
+}
+
+//nodeID identifies the commit hash of the repository among the nodes
+func nodeID(repositoryID int, hash string) string {
+	return strconv.Itoa(repositoryID) + ":" + hash
+}
@@ -0,0 +1,112 @@
+package exporter
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// WriteGraphML writes the graph as GraphML, edges going
+// from the bug-introducing commits to their fixes
+func (graph *Graph) WriteGraphML(w io.Writer) error {
+
+	document := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{"repository_id", "node", "repository_id", "int"},
+			{"author_email", "node", "author_email", "string"},
+			{"timestamp", "node", "timestamp", "long"},
+			{"buggy", "node", "buggy", "boolean"},
+			{"fixing", "node", "fixing", "boolean"},
+			{"report_ids", "edge", "report_ids", "string"},
+			{"provenance", "edge", "provenance", "string"},
+			{"szz", "edge", "szz", "string"},
+		},
+		Graph: graphMLGraph{ID: "fixes", EdgeDefault: "directed"},
+	}
+
+	for _, node := range graph.Nodes {
+		document.Graph.Nodes = append(document.Graph.Nodes, graphMLNode{
+			ID: nodeID(node.RepositoryID, node.Hash),
+			Data: []graphMLData{
+				{"repository_id", strconv.Itoa(node.RepositoryID)},
+				{"author_email", node.AuthorEmail},
+				{"timestamp", strconv.Itoa(node.Timestamp)},
+				{"buggy", strconv.FormatBool(node.Buggy)},
+				{"fixing", strconv.FormatBool(node.Fixing)},
+			},
+		})
+	}
+
+	for _, edge := range graph.Edges {
+
+		//The blamed lines as file:line in the parent of the fix
+		lines, szz := []string{}, ""
+		for _, provenance := range edge.Provenance {
+			lines = append(lines, provenance.File+":"+strconv.Itoa(provenance.Line))
+			szz = provenance.SZZ
+		}
+
+		document.Graph.Edges = append(document.Graph.Edges, graphMLEdge{
+			Source: nodeID(edge.RepositoryID, edge.Introducer),
+			Target: nodeID(edge.RepositoryID, edge.Fix),
+			Data: []graphMLData{
+				{"report_ids", strings.Join(edge.ReportIDs, " ")},
+				{"provenance", strings.Join(lines, " ")},
+				{"szz", szz},
+			},
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+
+	return err
+}
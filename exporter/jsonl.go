@@ -0,0 +1,27 @@
+package exporter
+
+import (
+	"encoding/json"
+	"io"
+)
+
+//WriteJSONLines writes the graph as JSON lines, the nodes then the
+//edges, each line holding a "node" or an "edge" object
+func (graph *Graph) WriteJSONLines(w io.Writer) error {
+
+	encoder := json.NewEncoder(w)
+
+	for _, node := range graph.Nodes {
+		if err := encoder.Encode(map[string]*Node{"node": node}); err != nil {
+			return err
+		}
+	}
+
+	for _, edge := range graph.Edges {
+		if err := encoder.Encode(map[string]*Edge{"edge": edge}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,90 +1,849 @@
-package main
-
-import (
-	"fmt"
-
-	_ "github.com/go-sql-driver/mysql"
-	"github.com/mathieunls/deepchange-downloader/jira"
-)
-
-func main() {
-
-	// gitCMD := git.New()
-
-	// gitCMD.Commits("/home/math/E_DRIVE/ace", "")
-
-	// basePath := pwd + "/src/github.com/BUMPER/IssueDownloader/data/netbeans/"
-	// baseURL := "https://netbeans.org/bugzilla/show_bug.cgi?ctype=xml&id="
-
-	if err != nil {
-		fmt.Printf(err.Error())
-		return
-	}
-
-	fmt.Println(jira.NewSQL(db, "RS", "129998", "jira25"))
-
-	// inFile, _ := os.Open(pwd + "/src/github.com/BUMPER/IssueDownloader/data/netbeans.csv")
-	// defer inFile.Close()
-	// scanner := bufio.NewScanner(inFile)
-	// scanner.Split(bufio.ScanLines)
-
-	// for scanner.Scan() {
-	// 	id := scanner.Text()
-	// 	report, _ := bugzilla.New(basePath+id+".xml", baseURL+id)
-	// 	report.WriteWordsToDisk(db, "bug_netbeans_")
-	// }
-
-	// inFile, _ = os.Open(pwd + "/src/github.com/BUMPER/IssueDownloader/data/apache.csv")
-	// defer inFile.Close()
-	// scanner = bufio.NewScanner(inFile)
-	// scanner.Split(bufio.ScanLines)
-
-	// for scanner.Scan() {
-	// 	id := scanner.Text()
-	// 	basePath := pwd + "/src/github.com/BUMPER/IssueDownloader/data/apache/"
-	// 	baseURL := "https://issues.apache.org/jira/si/jira.issueviews:issue-xml/" + id + "/" + id + ".xml"
-	// 	reportb, _ := jira.New(basePath+id+".xml", baseURL)
-	// 	reportb.WriteWordsToDisk(db, "bug_apache_")
-	// }
-
-	// //We're done with mysql.
-	// //All in memory from here
-	// db.Close()
-
-	//wordnet.IdfMap(pwd+"/src/github.com/BUMPER/IssueDownloader/data/tf/apache.tf.wnet", "bug_apache_", []string{"ambari"}, []string{"1", "2", "3", "4"}, []string{"3"}, 5, 10)
-
-	// apacheProducts := []string{"ambari", "hbase", "cassandra", "hive", "flume"}
-	// netbeansProducts := []string{"editor", "javaee", "cnd", "java", "platform"}
-
-	// // wordnet.IdfMap(pwd+"/src/github.com/BUMPER/IssueDownloader/data/tf/apache.tf.wnet", "bug_apache_", []string{apacheProducts[0]}, []string{"1", "2", "3", "4"}, []string{"4"}, 10, 20)
-	// // wordnet.IdfMap(pwd+"/src/github.com/BUMPER/IssueDownloader/data/tf/apache.tf.wnet", "bug_apache_", []string{apacheProducts[0]}, []string{"1", "2", "3", "4"}, []string{"3"}, 10, 20)
-	// // // wordnet.IdfMap(pwd+"/src/github.com/BUMPER/IssueDownloader/data/tf/apache.tf.wnet", "bug_apache_", []string{apacheProducts[0]}, []string{"1", "2", "3", "4"}, []string{"4"}, 10, 20)
-
-	// for i := 0; i < len(apacheProducts); i++ {
-	// 	wordnet.IdfMap(pwd+"/src/github.com/BUMPER/IssueDownloader/data/tf/apache.tf.wnet", "bug_apache_", []string{apacheProducts[i]}, []string{"1", "2", "3", "4"}, []string{"3"}, 500, 500000, false)
-	// 	//wordnet.IdfMap(pwd+"/src/github.com/BUMPER/IssueDownloader/data/tf/apache.tf.wnet", "bug_apache_", []string{apacheProducts[i]}, []string{"1", "2", "3", "4"}, []string{"4"}, 40, 120, false)
-	// 	// wordnet.IdfMap(pwd+"/src/github.com/BUMPER/IssueDownloader/data/tf/apache.tf.wnet", "bug_apache_", []string{apacheProducts[i]}, []string{"1", "2", "3", "4"}, []string{"3", "4"}, 40, 120, false)
-
-	// 	// wordnet.IdfMap(pwd+"/src/github.com/BUMPER/IssueDownloader/data/tf/apache.tf.wnet", "bug_apache_", []string{apacheProducts[i]}, []string{"1", "2", "3", "4"}, []string{"4"}, 40, 120)
-	// }
-
-	// for i := 0; i < len(netbeansProducts); i++ {
-	// 	wordnet.IdfMap(pwd+"/src/github.com/BUMPER/IssueDownloader/data/tf/netbeans.tf.wnet", "bug_netbeans_", []string{netbeansProducts[i]}, []string{"1", "2", "3", "4"}, []string{"3"}, 500, 500000, false)
-	// 	//wordnet.IdfMap(pwd+"/src/github.com/BUMPER/IssueDownloader/data/tf/netbeans.tf.wnet", "bug_netbeans_", []string{netbeansProducts[i]}, []string{"1", "2", "3", "4"}, []string{"4"}, 40, 120, false)
-	// 	// wordnet.IdfMap(pwd+"/src/github.com/BUMPER/IssueDownloader/data/tf/netbeans.tf.wnet", "bug_netbeans_", []string{netbeansProducts[i]}, []string{"1", "2", "3", "4"}, []string{"3", "4"}, 40, 120, false)
-	// 	// wordnet.IdfMap(pwd+"/src/github.com/BUMPER/IssueDownloader/data/tf/netbeans.tf.wnet", "bug_netbeans_", []string{netbeansProducts[i]}, []string{"1", "2", "3", "4"}, []string{"4"}, 40, 80)
-	// }
-
-	//wordnet.IdfMap(pwd+"/src/github.com/BUMPER/IssueDownloader/data/tf/netbeans.tf.wnet", "bug_netbeans_")
-	//wordnet.IdfMap(pwd+"/src/github.com/BUMPER/IssueDownloader/data/tf/apache.tf.wnet", "bug_apache_")
-
-	/*
-		COMMANDS
-
-		- Train files  ls *.libsvm | while read file; do lines=$(cat $file | wc -l); train=$(($lines / 10 * 8)); head $file -n $train > $file.train;  done
-		- Test files: ls *.libsvm | while read file; do lines=$(cat $file | wc -l); train=$(($lines / 10 * 8)); test=$(($lines - $train)); tail $file -n $test > $file.test;  done
-		- Run tests ls  -- *test *train | sed -e 's/\.train.*$//' | sed -e 's/\.test*$//' | uniq | while read file; do echo $file >> r.txt; hectorcv --method svm --train $file.train --test $file.test --cv 5 | tail -n 1 >> r.txt; done
-		- cleanup rm *test *train *libsvm *xml *txt
-	*/
-
-}
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/mathieunls/deepchange-downloader/analyzer"
+	"github.com/mathieunls/deepchange-downloader/bugzilla"
+	"github.com/mathieunls/deepchange-downloader/config"
+	"github.com/mathieunls/deepchange-downloader/exporter"
+	"github.com/mathieunls/deepchange-downloader/git"
+	"github.com/mathieunls/deepchange-downloader/jira"
+	"github.com/mathieunls/deepchange-downloader/persistence"
+	"github.com/mathieunls/deepchange-downloader/pogo"
+	gcache "github.com/mathieunls/gcache/src"
+)
+
+const usage = `usage: extract <command> [flags]
+
+Commands:
+  ingest   reads the history of the repositories and stores their commits
+  link     ingests the repositories and links fixing commits to bug-introducing ones
+  export   writes the metrics of every commit of the repositories as CSV
+           and the graph of the fixes as GraphML, DOT or JSON lines
+  stats    prints statistics about the history of the repositories
+  model    trains the defect prediction model on the linked commits of the repositories
+  evaluate trains the model on the oldest linked commits and tests it on the latest ones
+  warmup   loads the database and the log directories into the cache
+
+The repositories, tracker and outputs come from the JSON study given
+with -config or, for a single repository, from the other flags.
+
+Run 'extract <command> -h' for the flags of a command.
+`
+
+//options holds the flags shared by every command
+type options struct {
+	configPath          string
+	repoDir             string
+	repoName            string
+	workingDir          string
+	lastCommit          string
+	repoID              int
+	threads             int
+	fixPattern          string
+	fixConventions      string
+	reviewerPattern     string
+	reviewerConventions string
+	p4                  bool
+	entropyWindowDays   int
+	changeWindowDays    int
+	szz                 string
+	excludeTests        bool
+	mergePolicy         string
+	firstParent         bool
+	allRefs             bool
+	aliasFile           string
+	blameMoves          bool
+	blameCopies         bool
+	blameWhitespace     bool
+	blameIgnoreRevs     string
+	blameIgnoreRevsFile string
+	timeFilter          string
+	linkTimeoutMinutes  int
+	suspiciousOutput    string
+	dsn                 string
+	dbName              string
+	gram                int
+	jiraKey             string
+	jiraDB              string
+	bugzillaDir         string
+	bugzillaDB          string
+	bugzillaURL         string
+	bugzillaArchive     string
+	bugzillaRate        float64
+	logDir              string
+	output              string
+	format              string
+	warmup              bool
+	testRatio           float64
+	gapDays             int
+	folds               int
+}
+
+//environment holds what the commands operate on
+type environment struct {
+	ctx            context.Context
+	opts           *options
+	study          *config.Study
+	db             *sql.DB
+	trackerDB      *sql.DB
+	bugzillaLinker *bugzilla.RESTBugzillaLinker
+	linked         bool
+	suspicious     []git.Suspicion
+}
+
+func main() {
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	commands := map[string]func(*environment) error{
+		"ingest":   ingest,
+		"link":     link,
+		"export":   export,
+		"stats":    stats,
+		"model":    model,
+		"evaluate": evaluate,
+		"warmup": func(env *environment) error {
+			fmt.Println("Cache warmed up")
+			return nil
+		},
+	}
+
+	command, present := commands[os.Args[1]]
+	if !present {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	opts := parseFlags(os.Args[1], os.Args[2:])
+	if os.Args[1] == "warmup" {
+		opts.warmup = true
+	}
+
+	env, err := opts.open()
+	if err == nil {
+		//Interrupting stops the linking cleanly
+		var cancel context.CancelFunc
+		env.ctx, cancel = signal.NotifyContext(env.ctx, os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		if err = command(env); err == nil {
+			err = env.writeSuspicious()
+		}
+		env.close()
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+//parseFlags parses the flags of the given command
+func parseFlags(command string, args []string) *options {
+
+	opts := &options{}
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+
+	flags.StringVar(&opts.configPath, "config", "", "JSON file describing the study, replaces the repository, tracker and output flags")
+	flags.StringVar(&opts.repoDir, "repo-dir", "", "directory containing the repository")
+	flags.StringVar(&opts.repoName, "repo-name", "", "name of the repository inside repo-dir")
+	flags.StringVar(&opts.workingDir, "working-dir", "", "directory where the repository is cloned and logs are written (default repo-dir)")
+	flags.StringVar(&opts.lastCommit, "last-commit", "", "hash of the last ingested commit (default the watermark stored in the database)")
+	flags.IntVar(&opts.repoID, "repo-id", 0, "id of the repository in the database")
+	flags.IntVar(&opts.threads, "threads", 12, "number of linking workers")
+	flags.StringVar(&opts.fixPattern, "fix-pattern", "", "regex extracting the fixed report ids, captured by the group named id")
+	flags.StringVar(&opts.fixConventions, "fix-conventions", "", "comma-separated conventions referencing fixed reports, jira requires -jira-key: "+conventionNames())
+	flags.StringVar(&opts.reviewerPattern, "reviewer-pattern", "", "regex extracting the reviewers, captured by the group named id")
+	flags.StringVar(&opts.reviewerConventions, "reviewer-conventions", "", "comma-separated conventions referencing reviewers: "+conventionNames())
+	flags.BoolVar(&opts.p4, "p4", true, "extract git-p4 depot paths and change lists")
+	flags.IntVar(&opts.entropyWindowDays, "entropy-window-days", 0, "days of history covered by the history entropy, 0 to skip it")
+	flags.IntVar(&opts.changeWindowDays, "change-window-days", 365, "days of history covered by the unique changes")
+	flags.StringVar(&opts.szz, "szz", git.SZZOriginal, "SZZ variant locating the fixed bugs: "+strings.Join(git.SZZVariants, ", "))
+	flags.BoolVar(&opts.excludeTests, "exclude-tests", false, "don't blame the lines of test files modified by the fixes")
+	flags.StringVar(&opts.mergePolicy, "merge-policy", git.MergeSkip, "how merges are measured and linked: "+strings.Join(git.MergePolicies, ", "))
+	flags.BoolVar(&opts.firstParent, "first-parent", false, "ingest the first-parent history only")
+	flags.BoolVar(&opts.allRefs, "all-refs", false, "ingest the history of all the refs instead of HEAD")
+	flags.StringVar(&opts.aliasFile, "alias-file", "", "file in the .mailmap format unifying the developers, before the repository's .mailmap")
+	flags.BoolVar(&opts.blameMoves, "blame-moves", false, "blame the lines moved within a file to their origin")
+	flags.BoolVar(&opts.blameCopies, "blame-copies", false, "blame the lines moved or copied from other files to their origin")
+	flags.BoolVar(&opts.blameWhitespace, "blame-ignore-whitespace", false, "ignore whitespace changes when blaming")
+	flags.StringVar(&opts.blameIgnoreRevs, "blame-ignore-revs", "", "comma-separated revisions ignored when blaming, i.e. mass reformatting")
+	flags.StringVar(&opts.timeFilter, "time-filter", git.TimeFilterOff, "candidates authored after the fixed report was opened: "+strings.Join(git.TimeFilters, ", "))
+	flags.IntVar(&opts.linkTimeoutMinutes, "link-timeout-minutes", 60, "minutes after which the linking of a fix is abandoned, 0 for no limit")
+	flags.StringVar(&opts.suspiciousOutput, "suspicious-output", "", "CSV file listing the candidates flagged or discarded by the time filter")
+	flags.StringVar(&opts.blameIgnoreRevsFile, "blame-ignore-revs-file", "", "file listing revisions ignored when blaming, like .git-blame-ignore-revs")
+	flags.StringVar(&opts.dsn, "dsn", "", "MySQL data source name, i.e. user:password@tcp(localhost:3306)/bumper")
+	flags.StringVar(&opts.dbName, "db-name", "bumper", "name of the MySQL database")
+	flags.IntVar(&opts.gram, "gram", 1, "size of the n-grams stored for texts")
+	flags.StringVar(&opts.jiraKey, "jira-key", "", "original key of the Jira project, i.e. RS")
+	flags.StringVar(&opts.jiraDB, "jira-db", "", "name of the Jira database used as report prefix")
+	flags.StringVar(&opts.bugzillaDir, "bugzilla-dir", "", "directory of the show_bug.cgi?ctype=xml documents of the Bugzilla reports, i.e. 1234.xml")
+	flags.StringVar(&opts.bugzillaDB, "bugzilla-db", "", "name of the Bugzilla tracker used as report prefix")
+	flags.StringVar(&opts.bugzillaURL, "bugzilla-url", "", "base url of the Bugzilla REST API, i.e. https://bugzilla.mozilla.org, the key is read from BUGZILLA_API_KEY")
+	flags.StringVar(&opts.bugzillaArchive, "bugzilla-archive", "", "directory archiving the responses of the Bugzilla REST API, read alone without -bugzilla-url")
+	flags.Float64Var(&opts.bugzillaRate, "bugzilla-rate", 1, "requests per second sent to the Bugzilla REST API")
+	flags.StringVar(&opts.logDir, "log-dir", "", "directory caching diffs and blames (default working-dir/cache/repo-name/)")
+	flags.StringVar(&opts.output, "output", "", "file written by export and model")
+	flags.StringVar(&opts.format, "format", config.OutputCSV, "format of -output: csv, graphml, dot or jsonl")
+	flags.BoolVar(&opts.warmup, "warmup", false, "warm up the cache before running")
+	flags.Float64Var(&opts.testRatio, "test-ratio", 0.3, "ratio of the most recent commits evaluate tests on")
+	flags.IntVar(&opts.gapDays, "gap-days", 0, "days between the training and the testing commits, bugs take time to be fixed")
+	flags.IntVar(&opts.folds, "folds", 0, "number of consecutive periods evaluate tests on, replaces -test-ratio")
+
+	flags.Parse(args)
+
+	return opts
+}
+
+//splitList splits a flag value on sep, an empty sep
+//meaning the whole value is the only element
+func splitList(value string, sep string) []string {
+
+	if value == "" {
+		return nil
+	}
+
+	if sep == "" {
+		return []string{value}
+	}
+
+	return strings.Split(value, sep)
+}
+
+//conventionNames lists the known referencing conventions
+func conventionNames() string {
+
+	names := []string{}
+	for name := range pogo.Conventions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
+
+//loadStudy returns the study given with -config or, without it,
+//the single repository study described by the other flags
+func (opts *options) loadStudy() (*config.Study, error) {
+
+	if opts.configPath != "" {
+		return config.Load(opts.configPath)
+	}
+
+	study := &config.Study{
+		FixPatterns:         splitList(opts.fixPattern, ""),
+		FixConventions:      splitList(opts.fixConventions, ","),
+		ReviewerPatterns:    splitList(opts.reviewerPattern, ""),
+		ReviewerConventions: splitList(opts.reviewerConventions, ","),
+		P4:                  &opts.p4,
+		Threads:             opts.threads,
+		EntropyWindowDays:   opts.entropyWindowDays,
+		ChangeWindowDays:    opts.changeWindowDays,
+		SZZ:                 opts.szz,
+		ExcludeTests:        opts.excludeTests,
+		MergePolicy:         opts.mergePolicy,
+		FirstParent:         opts.firstParent,
+		AllRefs:             opts.allRefs,
+		AliasFile:           opts.aliasFile,
+		TimeFilter:          opts.timeFilter,
+		LinkTimeoutMinutes:  &opts.linkTimeoutMinutes,
+		Blame: config.Blame{
+			DetectMoves:      opts.blameMoves,
+			DetectCopies:     opts.blameCopies,
+			IgnoreWhitespace: opts.blameWhitespace,
+			IgnoreRevs:       splitList(opts.blameIgnoreRevs, ","),
+			IgnoreRevsFile:   opts.blameIgnoreRevsFile,
+		},
+	}
+
+	if opts.repoDir != "" || opts.repoName != "" {
+		study.Repositories = []config.Repository{{
+			ID:                 opts.repoID,
+			Name:               opts.repoName,
+			Dir:                opts.repoDir,
+			WorkingDir:         opts.workingDir,
+			LogDir:             opts.logDir,
+			LastIngestedCommit: opts.lastCommit,
+		}}
+	}
+
+	if opts.dsn != "" {
+		study.Outputs = append(study.Outputs, config.Output{
+			Type:     config.OutputMySQL,
+			DSN:      opts.dsn,
+			Database: opts.dbName,
+			Gram:     opts.gram,
+		})
+
+		if opts.jiraKey != "" {
+			study.Tracker = config.Tracker{
+				Type:         config.TrackerJiraMySQL,
+				DSN:          opts.dsn,
+				ProjectKey:   opts.jiraKey,
+				DatabaseName: opts.jiraDB,
+			}
+		}
+	}
+
+	//The key restricts the jira convention, with or without the tracker
+	if opts.jiraKey != "" && study.Tracker.Type == config.TrackerNone {
+		study.Tracker.ProjectKey = opts.jiraKey
+	}
+
+	if opts.bugzillaDir != "" {
+		study.Tracker = config.Tracker{
+			Type:         config.TrackerBugzillaXML,
+			Dir:          opts.bugzillaDir,
+			DatabaseName: opts.bugzillaDB,
+		}
+	}
+
+	if opts.bugzillaURL != "" || opts.bugzillaArchive != "" {
+		study.Tracker = config.Tracker{
+			Type:              config.TrackerBugzillaREST,
+			URL:               opts.bugzillaURL,
+			Dir:               opts.bugzillaArchive,
+			DatabaseName:      opts.bugzillaDB,
+			RequestsPerSecond: opts.bugzillaRate,
+		}
+	}
+
+	if opts.output != "" {
+		study.Outputs = append(study.Outputs, config.Output{
+			Type: opts.format,
+			Path: opts.output,
+		})
+	}
+
+	if opts.suspiciousOutput != "" {
+		study.Outputs = append(study.Outputs, config.Output{
+			Type: config.OutputSuspicious,
+			Path: opts.suspiciousOutput,
+		})
+	}
+
+	study.SetDefaults()
+
+	//warmup doesn't need any repository
+	if len(study.Repositories) == 0 && opts.warmup {
+		return study, nil
+	}
+
+	return study, study.Validate()
+}
+
+//open loads the study and connects to its databases
+func (opts *options) open() (*environment, error) {
+
+	study, err := opts.loadStudy()
+	if err != nil {
+		return nil, err
+	}
+
+	env := &environment{ctx: context.Background(), opts: opts, study: study}
+
+	if output := study.Output(config.OutputMySQL); output != nil {
+		if env.db, err = openDB(output.DSN); err != nil {
+			return nil, err
+		}
+	}
+
+	if study.Tracker.Type == config.TrackerJiraMySQL {
+		if output := study.Output(config.OutputMySQL); output != nil && output.DSN == study.Tracker.DSN {
+			env.trackerDB = env.db
+		} else if env.trackerDB, err = openDB(study.Tracker.DSN); err != nil {
+			env.close()
+			return nil, err
+		}
+	}
+
+	//The linker is shared by the commands, and so is its rate limit
+	if tracker := study.Tracker; tracker.Type == config.TrackerBugzillaREST {
+		env.bugzillaLinker = &bugzilla.RESTBugzillaLinker{
+			BaseURL:           tracker.URL,
+			APIKey:            tracker.APIKey,
+			ArchiveDir:        tracker.Dir,
+			DatabaseName:      tracker.DatabaseName,
+			RequestsPerSecond: tracker.RequestsPerSecond,
+			Retries:           *tracker.Retries,
+			Backoff:           time.Duration(tracker.BackoffSeconds) * time.Second,
+		}
+	}
+
+	if opts.warmup {
+		if env.db == nil {
+			env.close()
+			return nil, errors.New("warming up the cache requires a mysql output")
+		}
+
+		logDirs := []string{}
+		for _, repo := range study.Repositories {
+			logDirs = append(logDirs, repo.LogDir)
+		}
+		persistence.WarmupCache(env.db, logDirs)
+	}
+
+	return env, nil
+}
+
+//openDB opens and pings a MySQL database
+func openDB(dsn string) (*sql.DB, error) {
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+//close closes the databases of the environment
+func (env *environment) close() {
+
+	if env.trackerDB != nil && env.trackerDB != env.db {
+		env.trackerDB.Close()
+	}
+
+	if env.db != nil {
+		env.db.Close()
+	}
+}
+
+//newCMD wires a git.CMD with the adaptor and the linker described
+//by the study. Without database, nothing is synced but the fixes are
+//still linked with the reports of the tracker, as the time filter needs
+func (env *environment) newCMD(withDB bool) *git.CMD {
+
+	gitCMD := git.New()
+	gitCMD.Threads = env.study.Threads
+	gitCMD.IsP4 = *env.study.P4
+	gitCMD.EntropyWindow = time.Duration(env.study.EntropyWindowDays) * 24 * time.Hour
+	gitCMD.ChangeWindow = time.Duration(env.study.ChangeWindowDays) * 24 * time.Hour
+	gitCMD.SZZ = env.study.SZZ
+	gitCMD.ExcludeTests = env.study.ExcludeTests
+	gitCMD.MergePolicy = env.study.MergePolicy
+	gitCMD.FirstParent = env.study.FirstParent
+	gitCMD.AllRefs = env.study.AllRefs
+	gitCMD.AliasFile = env.study.AliasFile
+	gitCMD.TimeFilter = env.study.TimeFilter
+	gitCMD.LinkTimeout = time.Duration(*env.study.LinkTimeoutMinutes) * time.Minute
+	gitCMD.Blame = git.BlameOptions{
+		DetectMoves:      env.study.Blame.DetectMoves,
+		DetectCopies:     env.study.Blame.DetectCopies,
+		IgnoreWhitespace: env.study.Blame.IgnoreWhitespace,
+		IgnoreRevs:       env.study.Blame.IgnoreRevs,
+		IgnoreRevsFile:   env.study.Blame.IgnoreRevsFile,
+	}
+
+	//The study is validated, extractors can't fail
+	if extractor, _ := env.study.FixExtractor(); extractor != nil {
+		gitCMD.FixExtractor = extractor
+	}
+
+	if extractor, _ := env.study.ReviewerExtractor(); extractor != nil {
+		gitCMD.ReviewerExtractor = extractor
+	}
+
+	if withDB && env.db != nil {
+		output := env.study.Output(config.OutputMySQL)
+		gitCMD.DBAdaptor = &persistence.MySQLAdaptor{
+			Db:           env.db,
+			DatabaseName: output.Database,
+			Gram:         output.Gram,
+			Cache:        gcache.GetCacheInstance(),
+		}
+	}
+
+	//The tracker is only read from
+	if env.trackerDB != nil {
+		gitCMD.ReportLinker = &jira.MySQLJiraLinker{
+			Db:           env.trackerDB,
+			ProjectKey:   env.study.Tracker.ProjectKey,
+			DatabaseName: env.study.Tracker.DatabaseName,
+		}
+	}
+
+	//The documents are local, reports are linked with or without database
+	if env.study.Tracker.Type == config.TrackerBugzillaXML {
+		gitCMD.ReportLinker = &bugzilla.XMLBugzillaLinker{
+			Dir:          env.study.Tracker.Dir,
+			DatabaseName: env.study.Tracker.DatabaseName,
+		}
+	}
+
+	if env.study.Tracker.Type == config.TrackerBugzillaREST {
+		gitCMD.ReportLinker = env.bugzillaLinker
+	}
+
+	return gitCMD
+}
+
+//ingest reads the commits of the repositories and syncs them
+func ingest(env *environment) error {
+
+	if env.db == nil {
+		return errors.New("ingest requires a mysql output")
+	}
+
+	gitCMD := env.newCMD(true)
+
+	for _, repo := range env.study.Repositories {
+
+		fixes, err := gitCMD.Ingest(repo.Dir, repo.Name, repo.LastIngestedCommit, repo.WorkingDir, repo.ID)
+		if err != nil {
+			return errors.New("ingesting " + repo.Name + ": " + err.Error())
+		}
+
+		//They are linked by the next link
+		fmt.Println("Fixes to link in", repo.Name+":", len(fixes))
+	}
+
+	return nil
+}
+
+//link ingests the commits of the repositories and links
+//the corrective ones with the commits they fix
+func link(env *environment) error {
+
+	gitCMD := env.newCMD(true)
+
+	for _, repo := range env.study.Repositories {
+		if _, err := env.linkRepository(gitCMD, repo); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//export writes the commit metrics as CSV and the fix graph to the other outputs
+func export(env *environment) error {
+
+	writers := map[string]func(io.Writer, []*pogo.Commit) error{
+		config.OutputCSV: writeCSV,
+		config.OutputGraphML: func(out io.Writer, commits []*pogo.Commit) error {
+			return exporter.NewGraph(commits).WriteGraphML(out)
+		},
+		config.OutputDOT: func(out io.Writer, commits []*pogo.Commit) error {
+			return exporter.NewGraph(commits).WriteDOT(out)
+		},
+		config.OutputJSONLines: func(out io.Writer, commits []*pogo.Commit) error {
+			return exporter.NewGraph(commits).WriteJSONLines(out)
+		},
+	}
+
+	outputs := []config.Output{}
+	linked := false
+
+	for _, output := range env.study.Outputs {
+		if _, present := writers[output.Type]; present {
+			outputs = append(outputs, output)
+			linked = linked || output.Type != config.OutputCSV
+		}
+	}
+
+	if len(outputs) == 0 {
+		return errors.New("export requires a csv, graphml, dot or jsonl output")
+	}
+
+	//Graphs are made of the links, only computed when required
+	commits := []*pogo.Commit{}
+	if linked {
+		var err error
+		if commits, err = env.linkedCommits(); err != nil {
+			return err
+		}
+	} else {
+		for _, repo := range env.study.Repositories {
+			repoCommits, _, err := env.newCMD(false).Commits(repo.Dir, repo.Name, repo.LastIngestedCommit, repo.WorkingDir, repo.ID)
+			if err != nil {
+				return errors.New("reading " + repo.Name + ": " + err.Error())
+			}
+			commits = append(commits, repoCommits...)
+		}
+	}
+
+	for _, output := range outputs {
+
+		file, err := os.Create(output.Path)
+		if err != nil {
+			return err
+		}
+
+		err = writers[output.Type](file, commits)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+
+		if err != nil {
+			return errors.New(output.Path + ": " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+//writeCSV writes one line of metrics per commit
+func writeCSV(out io.Writer, commits []*pogo.Commit) error {
+
+	w := csv.NewWriter(out)
+
+	w.Write([]string{
+		"repository_id", "hash", "author_email", "author_id", "timestamp", "is_buggy", "is_linked",
+		"subsystems", "directories", "files", "entrophy", "history_entrophy",
+		"line_added", "line_deleted", "line_total", "devs", "age",
+		"production_line_added", "production_line_deleted", "production_files", "production_subsystems",
+		"test_line_added", "test_line_deleted", "test_files", "test_subsystems",
+		"unique_change", "experience", "relative_experience",
+		"subsystem_experience", "glm_prob", "fixes"})
+
+	for _, commit := range commits {
+		w.Write([]string{
+			strconv.Itoa(commit.RepositoryID),
+			commit.CommitHash,
+			commit.AuthorEmail,
+			commit.AuthorID,
+			strconv.Itoa(commit.AuthorDateUnixTimestamp),
+			strconv.FormatBool(commit.ContainsBug),
+			strconv.FormatBool(commit.Linked),
+			strconv.Itoa(commit.Subsystems),
+			strconv.Itoa(commit.Directories),
+			strconv.Itoa(commit.Files),
+			strconv.FormatFloat(commit.Entrophy, 'f', 6, 64),
+			strconv.FormatFloat(commit.HistoryEntrophy, 'f', 6, 64),
+			strconv.Itoa(commit.LineAdded),
+			strconv.Itoa(commit.LineDeleted),
+			strconv.FormatFloat(commit.LineTotal, 'f', 6, 64),
+			strconv.Itoa(commit.Devs),
+			strconv.FormatFloat(commit.Age, 'f', 6, 64),
+			strconv.Itoa(commit.ProductionLineAdded),
+			strconv.Itoa(commit.ProductionLineDeleted),
+			strconv.Itoa(commit.ProductionFiles),
+			strconv.Itoa(commit.ProductionSubsystems),
+			strconv.Itoa(commit.TestLineAdded),
+			strconv.Itoa(commit.TestLineDeleted),
+			strconv.Itoa(commit.TestFiles),
+			strconv.Itoa(commit.TestSubsystems),
+			strconv.Itoa(commit.UniqueChange),
+			strconv.FormatFloat(commit.Exp, 'f', 6, 64),
+			strconv.FormatFloat(commit.RExp, 'f', 6, 64),
+			strconv.FormatFloat(commit.Sexp, 'f', 6, 64),
+			strconv.FormatFloat(commit.GlmProb, 'f', 6, 64),
+			strings.Join(commit.FixReportIDs, " ")})
+	}
+
+	w.Flush()
+	return w.Error()
+}
+
+//stats prints statistics about the history without syncing anything
+func stats(env *environment) error {
+
+	for _, repo := range env.study.Repositories {
+
+		fmt.Println("Repository:", repo.Name)
+
+		commits, _, err := env.newCMD(false).Commits(repo.Dir, repo.Name, repo.LastIngestedCommit, repo.WorkingDir, repo.ID)
+		if err != nil {
+			return errors.New("reading " + repo.Name + ": " + err.Error())
+		}
+
+		authors := make(map[string]struct{})
+		files := make(map[string]struct{})
+		classifications := make(map[string]int)
+
+		for _, commit := range commits {
+			authors[commit.AuthorEmail] = struct{}{}
+			for _, file := range commit.FilesChanged {
+				files[file] = struct{}{}
+			}
+			for classification, confidence := range commit.Classification {
+				if confidence > 0.0 {
+					classifications[classification]++
+				}
+			}
+		}
+
+		fmt.Println("Authors:", len(authors))
+		fmt.Println("Files:", len(files))
+		for classification, amount := range classifications {
+			fmt.Println("Classified "+classification+":", amount)
+		}
+	}
+
+	return nil
+}
+
+//model links the commits of the repositories, trains the defect prediction
+//model on them and prints its coefficients. The scored commits are written
+//as CSV when the study has a csv output
+func model(env *environment) error {
+
+	commits, err := env.linkedCommits()
+	if err != nil {
+		return err
+	}
+
+	glm := analyzer.NewLogistic()
+	if err = glm.Train(commits); err != nil {
+		return err
+	}
+
+	analyzer.Score(glm, commits)
+
+	fmt.Print(glm)
+	//The model is measured on the commits it is trained on, see evaluate
+	//for its performance on held-out commits
+	fmt.Println("In-sample AUC:", strconv.FormatFloat(analyzer.AUC(commits), 'f', 4, 64))
+
+	output := env.study.Output(config.OutputCSV)
+	if output == nil {
+		return nil
+	}
+
+	file, err := os.Create(output.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return writeCSV(file, commits)
+}
+
+//evaluate trains the defect prediction model on the oldest linked commits
+//of the repositories and prints its performance on the most recent ones
+func evaluate(env *environment) error {
+
+	commits, err := env.linkedCommits()
+	if err != nil {
+		return err
+	}
+
+	gap := time.Duration(env.opts.gapDays) * 24 * time.Hour
+
+	splits := analyzer.TimeSplits(commits, env.opts.folds, gap)
+	if env.opts.folds <= 0 {
+		split, err := analyzer.TimeSplit(commits, env.opts.testRatio, gap)
+		if err != nil {
+			return err
+		}
+		splits = []analyzer.Split{split}
+	}
+
+	for i, split := range splits {
+
+		evaluation, err := analyzer.Evaluate(analyzer.NewLogistic(), split, 0.5)
+		if err != nil {
+			return errors.New("split " + strconv.Itoa(i+1) + ": " + err.Error())
+		}
+
+		fmt.Println("Split", strconv.Itoa(i+1)+":", evaluation)
+	}
+
+	return nil
+}
+
+//linkedCommits reads and links the commits of the repositories with
+//the reports of the tracker, without syncing anything
+func (env *environment) linkedCommits() ([]*pogo.Commit, error) {
+
+	commits := []*pogo.Commit{}
+
+	for _, repo := range env.study.Repositories {
+
+		repoCommits, err := env.linkRepository(env.newCMD(false), repo)
+		if err != nil {
+			return nil, err
+		}
+
+		commits = append(commits, repoCommits...)
+	}
+
+	return commits, nil
+}
+
+//linkRepository reads the commits of repo and links the corrective ones
+//with the commits they fix. The candidates rejected by the time filter
+//are kept for writeSuspicious. It fails when git does or when the linking
+//is interrupted
+func (env *environment) linkRepository(gitCMD *git.CMD, repo config.Repository) ([]*pogo.Commit, error) {
+
+	commits, correctiveCommits, err := gitCMD.Commits(repo.Dir, repo.Name, repo.LastIngestedCommit, repo.WorkingDir, repo.ID)
+	if err != nil {
+		return nil, errors.New("reading " + repo.Name + ": " + err.Error())
+	}
+
+	suspicious, err := gitCMD.LinkCorrectiveCommitsContext(env.ctx, correctiveCommits, commits, repo.WorkingDir+repo.Name, repo.LogDir, repo.ID)
+	gitCMD.SaveLinked(repo.Name, repo.WorkingDir, correctiveCommits)
+
+	fmt.Println("Suspicious bug-introducing candidates in", repo.Name+":", len(suspicious))
+	env.suspicious = append(env.suspicious, suspicious...)
+	env.linked = true
+
+	if err != nil {
+		return nil, errors.New("linking " + repo.Name + ": " + err.Error())
+	}
+
+	return commits, nil
+}
+
+//writeSuspicious writes the candidates rejected by the time filter
+//to the suspicious-csv output of the study, if any, once linked
+func (env *environment) writeSuspicious() error {
+
+	output := env.study.Output(config.OutputSuspicious)
+	if output == nil || !env.linked {
+		return nil
+	}
+
+	file, err := os.Create(output.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+
+	w.Write([]string{
+		"repository_id", "candidate", "fix", "candidate_date",
+		"report_id", "report_date", "discarded", "reason"})
+
+	for _, suspicion := range env.suspicious {
+		w.Write([]string{
+			strconv.Itoa(suspicion.RepositoryID),
+			suspicion.Candidate,
+			suspicion.Fix,
+			suspicion.CandidateDate.Format(time.RFC3339),
+			suspicion.ReportID,
+			suspicion.ReportDate.Format(time.RFC3339),
+			strconv.FormatBool(suspicion.Discarded),
+			suspicion.Reason})
+	}
+
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,182 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+//Backend runs the git commands needed by CMD. Arguments are handed
+//to git as is, they are never interpreted by a shell. Diff and Blame
+//are called concurrently on the same repository
+type Backend interface {
+	//Clone clones from into to
+	Clone(ctx context.Context, from string, to string, bare bool) error
+	//Fetch updates the branches of a clone from its origin
+	Fetch(ctx context.Context, repoDir string) error
+	//RevParse returns the hash of rev
+	RevParse(ctx context.Context, repoDir string, rev string) (string, error)
+	//Log streams the output of git log
+	Log(ctx context.Context, repoDir string, args ...string) (io.ReadCloser, error)
+	//Diff returns the output of git diff
+	Diff(ctx context.Context, repoDir string, args ...string) ([]byte, error)
+	//Blame returns the output of git blame
+	Blame(ctx context.Context, repoDir string, args ...string) ([]byte, error)
+	//Show returns the content of a blob, i.e. rev:path
+	Show(ctx context.Context, repoDir string, blob string) ([]byte, error)
+	//MergeBase returns the best common ancestor of revs
+	MergeBase(ctx context.Context, repoDir string, revs ...string) (string, error)
+}
+
+//ExecBackend is a Backend running the git executable
+type ExecBackend struct {
+	//Path to the git executable, git is looked up in $PATH when empty
+	Path string
+}
+
+//command returns the git command running args in repoDir.
+//Paths are never quoted so they can be read back as is
+func (backend *ExecBackend) command(ctx context.Context, repoDir string, args ...string) *exec.Cmd {
+
+	path := backend.Path
+	if path == "" {
+		path = "git"
+	}
+
+	cmd := exec.CommandContext(ctx, path, append([]string{"-c", "core.quotePath=false"}, args...)...)
+	cmd.Dir = repoDir
+	//Concurrent commands run against the same repository,
+	//read-only ones must not take the index lock to refresh it
+	cmd.Env = append(os.Environ(), "GIT_OPTIONAL_LOCKS=0")
+
+	return cmd
+}
+
+//output runs args in repoDir and returns its standard output.
+//The standard error is part of the returned error, if any
+func (backend *ExecBackend) output(ctx context.Context, repoDir string, args ...string) ([]byte, error) {
+
+	var stderr bytes.Buffer
+
+	cmd := backend.command(ctx, repoDir, args...)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return out, errors.New("git " + strings.Join(args, " ") + ": " + err.Error() + ": " + strings.TrimSpace(stderr.String()))
+	}
+
+	return out, nil
+}
+
+//Clone clones from into to and enables the parallel index preload
+func (backend *ExecBackend) Clone(ctx context.Context, from string, to string, bare bool) error {
+
+	args := []string{"clone"}
+
+	if bare {
+		args = append(args, "--bare")
+	}
+
+	if _, err := backend.output(ctx, "", append(args, "--", from, to)...); err != nil {
+		return err
+	}
+
+	/*
+		core.preloadindex
+		Enable parallel index preload for operations like git diff
+		This can speed up operations like git diff and git status
+		especially on filesystems like NFS that have weak caching semantics
+		and thus relatively high IO latencies. With this set to true,
+		git will do the index comparison to the filesystem data in parallel,
+		allowing overlapping IO's.
+	*/
+	_, err := backend.output(ctx, to, "config", "core.preloadindex", "true")
+
+	return err
+}
+
+//Fetch updates the branches of a clone, bare or not, from its origin
+func (backend *ExecBackend) Fetch(ctx context.Context, repoDir string) error {
+
+	_, err := backend.output(ctx, repoDir, "fetch", "--prune", "origin", "+refs/heads/*:refs/heads/*")
+
+	return err
+}
+
+//RevParse returns the hash of rev
+func (backend *ExecBackend) RevParse(ctx context.Context, repoDir string, rev string) (string, error) {
+
+	out, err := backend.output(ctx, repoDir, "rev-parse", "--verify", "--end-of-options", rev+"^{commit}")
+
+	return strings.TrimSpace(string(out)), err
+}
+
+//Log streams the output of git log. The error of the command, if any,
+//is returned when closing the stream
+func (backend *ExecBackend) Log(ctx context.Context, repoDir string, args ...string) (io.ReadCloser, error) {
+
+	cmd := backend.command(ctx, repoDir, append([]string{"log"}, args...)...)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return &commandReader{ReadCloser: stdout, cmd: cmd, stderr: stderr}, nil
+}
+
+//Diff returns the output of git diff
+func (backend *ExecBackend) Diff(ctx context.Context, repoDir string, args ...string) ([]byte, error) {
+	return backend.output(ctx, repoDir, append([]string{"diff", "--no-color", "--no-ext-diff"}, args...)...)
+}
+
+//Blame returns the output of git blame
+func (backend *ExecBackend) Blame(ctx context.Context, repoDir string, args ...string) ([]byte, error) {
+	return backend.output(ctx, repoDir, append([]string{"blame"}, args...)...)
+}
+
+//Show returns the content of a blob, i.e. rev:path
+func (backend *ExecBackend) Show(ctx context.Context, repoDir string, blob string) ([]byte, error) {
+	return backend.output(ctx, repoDir, "cat-file", "blob", blob)
+}
+
+//MergeBase returns the best common ancestor of revs, octopus merges included
+func (backend *ExecBackend) MergeBase(ctx context.Context, repoDir string, revs ...string) (string, error) {
+
+	out, err := backend.output(ctx, repoDir, append([]string{"merge-base", "--octopus"}, revs...)...)
+
+	return strings.TrimSpace(string(out)), err
+}
+
+//commandReader reads the standard output of a running
+//command and waits for it on Close
+type commandReader struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+}
+
+//Close waits for the command and returns its error, if any
+func (reader *commandReader) Close() error {
+
+	//Drain what's left so the command isn't blocked on a full pipe
+	io.Copy(ioutil.Discard, reader.ReadCloser)
+
+	if err := reader.cmd.Wait(); err != nil {
+		return errors.New(strings.Join(reader.cmd.Args, " ") + ": " + err.Error() + ": " + strings.TrimSpace(reader.stderr.String()))
+	}
+
+	return nil
+}
@@ -0,0 +1,238 @@
+package git
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mathieunls/deepchange-downloader/pogo"
+)
+
+//BlameOptions tune how annotate traces the lines of a fix back to the
+//commits introducing them. git blame always follows whole file renames
+type BlameOptions struct {
+	//DetectMoves attributes the lines moved within a file to their origin, -M
+	DetectMoves bool
+	//DetectCopies attributes the lines moved or copied from the other files
+	//modified by the same commit to their origin, -C
+	DetectCopies bool
+	//IgnoreWhitespace ignores whitespace changes, -w
+	IgnoreWhitespace bool
+	//IgnoreRevs are revisions, such as mass reformatting, whose lines
+	//are attributed to the commits they modified, --ignore-rev
+	IgnoreRevs []string
+	//IgnoreRevsFile is the path of a file listing revisions to ignore,
+	//one per line, like .git-blame-ignore-revs, --ignore-revs-file
+	IgnoreRevsFile string
+}
+
+//args returns the git blame arguments implementing the options
+func (options BlameOptions) args() []string {
+
+	args := []string{}
+
+	if options.DetectMoves {
+		args = append(args, "-M")
+	}
+
+	if options.DetectCopies {
+		args = append(args, "-C")
+	}
+
+	if options.IgnoreWhitespace {
+		args = append(args, "-w")
+	}
+
+	for _, rev := range options.IgnoreRevs {
+		args = append(args, "--ignore-rev", rev)
+	}
+
+	if options.IgnoreRevsFile != "" {
+		args = append(args, "--ignore-revs-file", options.IgnoreRevsFile)
+	}
+
+	return args
+}
+
+//fingerprint identifies the options in the ids of the cached blames, so
+//blames made with other options are never reused. It is empty for the
+//default options, which keeps the blames cached before they existed
+func (options BlameOptions) fingerprint() string {
+
+	args := options.args()
+	if len(args) == 0 {
+		return ""
+	}
+
+	hash := sha1.New()
+	hash.Write([]byte(strings.Join(args, "\x00")))
+
+	//The listed revisions may change while the path doesn't
+	if options.IgnoreRevsFile != "" {
+		if content, err := ioutil.ReadFile(options.IgnoreRevsFile); err == nil {
+			hash.Write(content)
+		}
+	}
+
+	return "_" + hex.EncodeToString(hash.Sum(nil))[:12]
+}
+
+//blameLine is the origin of a line of a file
+type blameLine struct {
+	Hash         string
+	AuthorTime   int
+	File         string
+	Line         int
+	Content      string
+	OriginalFile string
+	OriginalLine int
+}
+
+//blameFile blames the lines of file as it was before commit in a single git
+//blame, one -L range per run of consecutive lines. The blame is cached under
+//an id made of the commit, the file and the lines so it is only reused for the
+//same lines. The lines past the end of the file in the parent, which fail the
+//whole git blame, are left out of the ranges and missing from the result
+func (git *CMD) blameFile(ctx context.Context, commit *pogo.Commit, file string, lines []int, repoDir string, logDir string) []blameLine {
+
+	ranges := lineRanges(lines)
+	if len(ranges) == 0 {
+		return nil
+	}
+
+	parent := git.parentRevision(ctx, commit, repoDir)
+
+	//Merges are blamed against their merge base or first parent
+	revision := commit.CommitHash
+	if parent != commit.CommitHash+"^" {
+		revision += "_" + parent
+	}
+
+	digest := sha1.Sum([]byte(strings.Join(ranges, " ")))
+	blameID := "blame_" + revision + git.Blame.fingerprint() + "_" +
+		hex.EncodeToString(digest[:])[:12] + "_" + strings.Replace(file, "/", "--", -1)
+
+	// the porcelain output gives us the complete commit hash, even for lines of the
+	// root commit with '--root'. additionally, start looking at the commit's ancestor
+	porcelain := git.cachedOutput(ctx, "blame", blameID, logDir, func() ([]byte, error) {
+
+		content, err := git.Backend.Show(ctx, repoDir, parent+":"+file)
+		if err != nil {
+			return nil, err
+		}
+
+		length := strings.Count(string(content), "\n")
+		if len(content) > 0 && content[len(content)-1] != '\n' {
+			length++
+		}
+
+		existing := []int{}
+		for _, line := range lines {
+			if line >= 1 && line <= length {
+				existing = append(existing, line)
+			}
+		}
+
+		if len(existing) == 0 {
+			return []byte{}, nil
+		}
+
+		args := git.Blame.args()
+		for _, lineRange := range lineRanges(existing) {
+			args = append(args, "-L"+lineRange)
+		}
+
+		return git.Backend.Blame(ctx, repoDir,
+			append(args, "--porcelain", "--root", parent, "--", file)...)
+	})
+
+	blamed := parsePorcelain(string(porcelain))
+	for i := range blamed {
+		blamed[i].File = file
+	}
+
+	return blamed
+}
+
+//lineRanges returns the -L ranges, like 10,+3, covering the lines
+func lineRanges(lines []int) []string {
+
+	sorted := append([]int{}, lines...)
+	sort.Ints(sorted)
+
+	ranges := []string{}
+
+	for i := 0; i < len(sorted); {
+
+		j := i + 1
+		for j < len(sorted) && sorted[j] <= sorted[j-1]+1 {
+			j++
+		}
+
+		ranges = append(ranges, strconv.Itoa(sorted[i])+",+"+strconv.Itoa(sorted[j-1]-sorted[i]+1))
+		i = j
+	}
+
+	return ranges
+}
+
+//parsePorcelain parses the output of git blame --porcelain. Each
+//blamed line starts with a header made of the hash, the original line
+//number and the line number, followed by the details of the commit the
+//first time it appears and the content of the line, prefixed by a tab
+func parsePorcelain(porcelain string) []blameLine {
+
+	blamed := []blameLine{}
+	current := blameLine{}
+	authorTimes := make(map[string]int)
+	filenames := make(map[string]string)
+
+	for _, line := range strings.Split(porcelain, "\n") {
+
+		if strings.HasPrefix(line, "\t") {
+			current.Content = line[1:]
+			current.AuthorTime = authorTimes[current.Hash]
+			current.OriginalFile = filenames[current.Hash]
+			blamed = append(blamed, current)
+			continue
+		}
+
+		if strings.HasPrefix(line, "author-time ") {
+			authorTimes[current.Hash], _ = strconv.Atoi(strings.TrimPrefix(line, "author-time "))
+			continue
+		}
+
+		//The file of the line in the commit, only repeated when the
+		//commit is blamed for the lines of several files
+		if strings.HasPrefix(line, "filename ") {
+			filenames[current.Hash] = strings.TrimPrefix(line, "filename ")
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 3 || !isHash(fields[0]) {
+			continue
+		}
+
+		current.Hash = fields[0]
+		current.OriginalLine, _ = strconv.Atoi(fields[1])
+		current.Line, _ = strconv.Atoi(fields[2])
+	}
+
+	return blamed
+}
+
+func isHash(value string) bool {
+
+	if len(value) != 40 && len(value) != 64 {
+		return false
+	}
+
+	_, err := hex.DecodeString(value)
+
+	return err == nil
+}
@@ -0,0 +1,56 @@
+package git
+
+import "testing"
+
+//porcelain is the blame of lines 2, 5 and 15 of B.java, renamed from
+//A.java by fec6cf4 which changed line 5. The filename of fff15e5 is
+//only printed the first time it appears
+const porcelain = `fff15e5c312ecee224a3683efa624b6ca61d74a2 2 2 1
+author a
+author-mail <a@a>
+author-time 1577836800
+author-tz +0000
+committer a
+committer-mail <a@a>
+committer-time 1577836800
+committer-tz +0000
+summary c1
+boundary
+filename A.java
+	line 2;
+fec6cf44c1eaa0b56ed7f392a5a7594fbd97b774 5 5 1
+author a
+author-mail <a@a>
+author-time 1580515200
+author-tz +0000
+committer a
+committer-mail <a@a>
+committer-time 1577836800
+committer-tz +0000
+summary c2
+previous fff15e5c312ecee224a3683efa624b6ca61d74a2 A.java
+filename B.java
+	line five;
+fff15e5c312ecee224a3683efa624b6ca61d74a2 15 15 1
+	line 15;
+`
+
+func TestParsePorcelain(t *testing.T) {
+
+	expected := []blameLine{
+		{"fff15e5c312ecee224a3683efa624b6ca61d74a2", 1577836800, "", 2, "line 2;", "A.java", 2},
+		{"fec6cf44c1eaa0b56ed7f392a5a7594fbd97b774", 1580515200, "", 5, "line five;", "B.java", 5},
+		{"fff15e5c312ecee224a3683efa624b6ca61d74a2", 1577836800, "", 15, "line 15;", "A.java", 15},
+	}
+
+	actual := parsePorcelain(porcelain)
+	if len(actual) != len(expected) {
+		t.Fatalf("parsePorcelain returned %d lines, expected %d", len(actual), len(expected))
+	}
+
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Errorf("line %d = %+v, expected %+v", i, actual[i], expected[i])
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package git
+
+import (
+	"math"
+	"time"
+)
+
+//fileChange is the amount of lines a commit modified in a file
+type fileChange struct {
+	Timestamp int
+	File      string
+	Lines     int
+}
+
+//entropy returns the Shannon entropy of the distribution of the modified
+//lines over the files, normalized by its maximum, log2 of the number of files.
+//It ranges from 0, all the lines are in one file, to 1, the lines are evenly
+//spread over the files
+func entropy(locModified map[string]int) float64 {
+
+	total := 0
+	files := 0
+
+	for _, lines := range locModified {
+		total += lines
+		files++
+	}
+
+	if total == 0 || files < 2 {
+		return 0
+	}
+
+	h := 0.0
+	for _, lines := range locModified {
+		if lines > 0 {
+			p := float64(lines) / float64(total)
+			h -= p * math.Log2(p)
+		}
+	}
+
+	return h / math.Log2(float64(files))
+}
+
+//historyEntropy adds the changes of the commit made at unixTimeStamp to the
+//window of the state and returns the entropy of all the changes made within
+//window before it, as in Hassan's history complexity metric
+func (state *MetricState) historyEntropy(locModified map[string]int, unixTimeStamp int, window time.Duration) float64 {
+
+	for file, lines := range locModified {
+		state.Window = append(state.Window, fileChange{unixTimeStamp, file, lines})
+	}
+
+	since := unixTimeStamp - int(window.Seconds())
+
+	//Commits come in topological order, author dates are
+	//mostly sorted: drop the oldest changes from the front
+	first := 0
+	for first < len(state.Window) && state.Window[first].Timestamp < since {
+		first++
+	}
+	state.Window = state.Window[first:]
+
+	windowLOC := make(map[string]int)
+	for _, change := range state.Window {
+		if change.Timestamp >= since && change.Timestamp <= unixTimeStamp {
+			windowLOC[change.File] += change.Lines
+		}
+	}
+
+	return entropy(windowLOC)
+}
@@ -1,11 +1,14 @@
 package git
 
 import (
+	"context"
+	"crypto/sha1"
+	"errors"
 	"fmt"
-	"log"
-	"math"
+	"io"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -15,7 +18,6 @@ import (
 	"sync"
 
 	classifier "github.com/mathieunls/deepchange-downloader/classifiers"
-	"github.com/mathieunls/deepchange-downloader/jira"
 	"github.com/mathieunls/deepchange-downloader/persistence"
 	"github.com/mathieunls/deepchange-downloader/pogo"
 	gcache "github.com/mathieunls/gcache/src"
@@ -30,8 +32,23 @@ type CMD struct {
 	cleanCMD          string
 	headCommitHashCMD string
 	Threads           int
+	FixExtractor      pogo.ReferenceExtractor
+	ReviewerExtractor pogo.ReferenceExtractor
+	IsP4              bool
+	ExcludeTests      bool
+	AliasFile         string
+	MergePolicy       string
+	FirstParent       bool
+	AllRefs           bool
+	EntropyWindow     time.Duration
+	ChangeWindow      time.Duration
+	SZZ               string
+	TimeFilter        string
+	Blame             BlameOptions
+	LinkTimeout       time.Duration
 	ReportLinker      pogo.ReportLinker
 	DBAdaptor         persistence.DBAdaptor
+	Backend           Backend
 }
 
 // commitFile is an internal representation of
@@ -41,13 +58,13 @@ type commitFile struct {
 	LOC         int
 	Authors     map[string]struct{}
 	Lastchanged int
-	NUC         int
+	Changes     map[string]int
 }
 
 // devExperiences is an internal representation
 // of developers experiences on project's subsystem
 type devExperiences struct {
-	systems map[string]int
+	Systems map[string]int
 }
 
 // New returns a new GitCMD abstraction
@@ -70,36 +87,54 @@ func New() *CMD {
 	g.cleanCMD = "git clean -df"
 	g.headCommitHashCMD = "git rev-parse HEAD"
 	g.Threads = 12
+	//The conventions are valid patterns, no error can occur
+	g.FixExtractor, _ = pogo.NewFixExtractor(pogo.Conventions["bumper"])
+	g.ReviewerExtractor, _ = pogo.NewReviewerExtractor(pogo.Conventions["bumper-review"])
+	g.IsP4 = true
+	//Period covered by the history entropy, which isn't computed when 0
+	g.EntropyWindow = 0
+	//Period covered by the unique changes, bounding the changes kept per file
+	g.ChangeWindow = 365 * 24 * time.Hour
+	g.SZZ = SZZOriginal
+	g.TimeFilter = TimeFilterOff
+	//Merges are ingested but neither measured nor linked
+	g.MergePolicy = MergeSkip
+	//The history of HEAD, second parents included
+	g.FirstParent = false
+	g.AllRefs = false
+	//Developers are unified by .mailmap and heuristics only
+	g.AliasFile = ""
+	//Jobs aren't bounded when 0
+	g.LinkTimeout = time.Hour
 	g.ReportLinker = nil
 	g.DBAdaptor = nil
+	g.Backend = &ExecBackend{}
 	return &g
 }
 
 // commitStats extracts the statistics for a commit with
 // regards to previous commits
 func (git *CMD) commitStats(
-	//A string array comming from --numstats
-	//It contains strings like "1       2       cluster.R"
-	stats []string,
-	//All the commitFile we've seen before
-	//Map are pointer type. Modifications in here
+	//The files of the commit, comming from --raw --numstat
+	stats []numstat,
+	//All the commitFile we've seen before and all the
+	//experiences of all the devs. Modifications in here
 	//affects the caller
-	commitFiles map[string]commitFile,
-	//All the experiences of all the devs
-	//Once again, a pointer.
-	devsExp map[string]devExperiences,
-	//Unique name of commiter
+	state *MetricState,
+	//Unique name of commiter, the ID of the developer
 	author string,
 	//The timestamp (i.e. 1406214540)
 	unixTimeStamp int,
 	//A pointer to the commit to update
 	commit *pogo.Commit) {
 
-	//Following maps keep references of known authors,
-	//subsystems, directories and files; respectively.
+	//Following maps keep references of the authors and the
+	//changes of the files in the past, subsystems, directories
+	//and files; respectively.
 	//The map[string]struct{} is used to build a dictionary
 	//without needing additional space: struct{} cost nothing
 	authors := make(map[string]struct{})
+	changes := make(map[string]struct{})
 	subsystems := make(map[string]struct{})
 	directories := make(map[string]struct{})
 	files := make(map[string]struct{})
@@ -112,119 +147,158 @@ func (git *CMD) commitStats(
 	exp := 0.0  //experience of dev
 	rexp := 0.0 //relative experience with regards to file age
 	sexp := 0.0 //subsystem experience
-	nuc := 0    //number of unique modification
 	lt := 0     //total line in the file before the commit
+	aged := 0.0 //number of files changed before, which have an age
 
-	totalLOCModified := 0
+	//Production and test stats, lines added and deleted then
+	//files and subsystems
+	prodLA, prodLD, testLA, testLD := 0, 0, 0, 0
+	prodFiles := make(map[string]struct{})
+	prodSubsystems := make(map[string]struct{})
+	testFiles := make(map[string]struct{})
+	testSubsystems := make(map[string]struct{})
 
-	//Iterates over all files in the commit, for example
-	// 2       0       .gitignore
-	// 1       0       actors.json
-	// 48      0       cluster.R
-	for i := 0; i < len(stats); i++ {
+	commitFiles := state.CommitFiles
+	devsExp := state.DevExp
 
-		//Split on spaces
-		//2       0       .gitignore
-		//becomes [2,0,.gitignore]
-		fileStat := strings.Fields(stats[i])
+	totalLOCModified := 0
+	//lines added and deleted per file, for the entropy
+	locModified := make(map[string]int)
 
-		//discard blank lines
-		if len(fileStat) > 0 {
+	//Iterates over all files in the commit
+	for _, fileStat := range stats {
 
-			addeLines, err := strconv.Atoi(fileStat[0])
+		//Binary files have no lines, they are listed apart
+		if fileStat.Binary {
+			commit.BinaryFiles = append(commit.BinaryFiles, fileStat.Path)
+			continue
+		}
 
-			if err != nil {
-				addeLines = 0
-			}
+		addeLines := fileStat.Added
+		removedLines := fileStat.Deleted
+		fileName := fileStat.Path
 
-			removedLines, err := strconv.Atoi(fileStat[1])
+		//A renamed file keeps its history
+		if cFile, present := commitFiles[fileStat.OldPath]; present && fileStat.Status == "R" {
+			cFile.Name = fileName
+			commitFiles[fileName] = cFile
+			delete(commitFiles, fileStat.OldPath)
+		}
 
-			if err != nil {
-				removedLines = 0
-			}
+		totalLOCModified = totalLOCModified + addeLines + removedLines
+		locModified[fileName] += addeLines + removedLines
 
-			fileName := fileStat[2]
+		//The author is one of the developers of the file
+		authors[author] = struct{}{}
 
-			totalLOCModified = totalLOCModified + addeLines + removedLines
+		//We've seen that file already, update stats
+		if cFile, present := commitFiles[fileName]; present {
 
-			//Do we know that author ?
-			if _, present := authors[author]; !present {
-				authors[author] = struct{}{}
+			for dev := range cFile.Authors {
+				authors[dev] = struct{}{}
 			}
+			for hash, timestamp := range cFile.Changes {
+				//Only the changes of the window are kept
+				if timestamp < unixTimeStamp-int(git.ChangeWindow.Seconds()) {
+					delete(cFile.Changes, hash)
+					continue
+				}
+				changes[hash] = struct{}{}
+			}
+			lt += cFile.LOC
+			age += (float64(unixTimeStamp) - float64(cFile.Lastchanged)) / 86400.0
+			aged++
 
-			//We've seen that file already, update stats
-			if cFile, present := commitFiles[fileName]; present {
-
-				nuc += cFile.NUC
-				lt += cFile.LOC
-				age += (float64(unixTimeStamp) - float64(cFile.Lastchanged)) / 86400.0
+			cFile.LOC = cFile.LOC + addeLines - removedLines
+			cFile.Lastchanged = unixTimeStamp
+			cFile.Authors[author] = struct{}{}
+			cFile.Changes[commit.CommitHash] = unixTimeStamp
 
-				cFile.LOC = cFile.LOC + addeLines - removedLines
-				cFile.Lastchanged = unixTimeStamp
-				cFile.NUC = cFile.NUC + 1
-				cFile.Authors[author] = struct{}{}
+			//cFile is a copy
+			commitFiles[fileName] = cFile
 
-			} else {
+		} else {
 
-				commitFiles[fileName] = commitFile{fileName, addeLines - removedLines, authors, unixTimeStamp, 1}
+			commitFiles[fileName] = commitFile{
+				fileName,
+				addeLines - removedLines,
+				map[string]struct{}{author: {}},
+				unixTimeStamp,
+				map[string]int{commit.CommitHash: unixTimeStamp},
 			}
+		}
 
-			fileDirs := strings.Split(fileName, "/")
-
-			directory := "root"
-			subsystem := "root"
+		fileDirs := strings.Split(fileName, "/")
 
-			//Are we in a subsystem ?
-			if len(fileDirs) > 1 {
-				subsystem = fileDirs[0]
-				directory = strings.Join(append(fileDirs[:0], fileDirs[1:]...), "/")
-			}
+		directory := "root"
+		subsystem := "root"
 
-			//Do we known that subsystem ?
-			if _, present := subsystems[subsystem]; !present {
-				subsystems[subsystem] = struct{}{}
-			}
+		//Are we in a subsystem ?
+		if len(fileDirs) > 1 {
+			subsystem = fileDirs[0]
+			directory = strings.Join(append(fileDirs[:0], fileDirs[1:]...), "/")
+		}
 
-			//Do we know that dev XP ?
-			if _, present := devsExp[author]; !present {
+		//Do we known that subsystem ?
+		if _, present := subsystems[subsystem]; !present {
+			subsystems[subsystem] = struct{}{}
+		}
 
-				devMap := make(map[string]int)
-				devMap[subsystem] = 1
-				devsExp[author] = devExperiences{devMap}
-			} else {
+		//Do we know that dev XP ?
+		if _, present := devsExp[author]; !present {
 
-				devExp := devsExp[author]
+			devMap := make(map[string]int)
+			devMap[subsystem] = 1
+			devsExp[author] = devExperiences{devMap}
+		} else {
 
-				for _, val := range devExp.systems {
-					exp += float64(val)
-				}
+			devExp := devsExp[author]
 
-				if age != 0 {
+			for _, val := range devExp.Systems {
+				exp += float64(val)
+			}
 
-					rexp += (1/age + 1)
-				}
+			if age != 0 {
 
-				if _, present := devsExp[author].systems[subsystem]; !present {
-					devsExp[author].systems[subsystem] = 1
-				} else {
-					sexp += float64(devsExp[author].systems[subsystem])
-					devsExp[author].systems[subsystem]++
-				}
+				rexp += (1/age + 1)
 			}
 
-			//Do we know that dir ?
-			if _, present := directories[directory]; !present {
-				directories[directory] = struct{}{}
+			if _, present := devsExp[author].Systems[subsystem]; !present {
+				devsExp[author].Systems[subsystem] = 1
+			} else {
+				sexp += float64(devsExp[author].Systems[subsystem])
+				devsExp[author].Systems[subsystem]++
 			}
+		}
 
-			//Update commit wide stats
-			la += addeLines
-			ld += removedLines
-			nf++
-			files[fileName] = struct{}{}
+		//Do we know that dir ?
+		if _, present := directories[directory]; !present {
+			directories[directory] = struct{}{}
+		}
 
+		//Update commit wide stats
+		la += addeLines
+		ld += removedLines
+		nf++
+		files[fileName] = struct{}{}
+
+		//Tests are told apart by their path, i.e. src/test/, _test.go or spec/
+		if classifier.GetInstance().FileType(fileName, "", nil).Category == classifier.CategoryTest {
+			testLA += addeLines
+			testLD += removedLines
+			testFiles[fileName] = struct{}{}
+			testSubsystems[subsystem] = struct{}{}
+		} else {
+			prodLA += addeLines
+			prodLD += removedLines
+			prodFiles[fileName] = struct{}{}
+			prodSubsystems[subsystem] = struct{}{}
 		}
 
+		//A file added later at the same path is a new file
+		if fileStat.Status == "D" {
+			delete(commitFiles, fileName)
+		}
 	}
 
 	//Commit had files
@@ -232,6 +306,14 @@ func (git *CMD) commitStats(
 
 		commit.LineAdded = la
 		commit.LineDeleted = ld
+		commit.ProductionLineAdded = prodLA
+		commit.ProductionLineDeleted = prodLD
+		commit.ProductionFiles = len(prodFiles)
+		commit.ProductionSubsystems = len(prodSubsystems)
+		commit.TestLineAdded = testLA
+		commit.TestLineDeleted = testLD
+		commit.TestFiles = len(testFiles)
+		commit.TestSubsystems = len(testSubsystems)
 
 		fileSlice := make([]string, len(files))
 		i := 0
@@ -243,7 +325,10 @@ func (git *CMD) commitStats(
 		commit.Files = len(files)
 		commit.Subsystems = len(subsystems)
 		commit.Directories = len(directories)
-		commit.Age = age / nf
+		//Files added by the commit have no age
+		if aged > 0 {
+			commit.Age = age / aged
+		}
 
 		authorSlice := make([]string, len(authors))
 		i = 0
@@ -255,435 +340,771 @@ func (git *CMD) commitStats(
 		commit.Exp = exp / nf
 		commit.RExp = rexp / nf
 		commit.Sexp = sexp / nf
-		commit.UniqueChange = nuc
+		commit.UniqueChange = len(changes)
 		commit.LineTotal = float64(lt) / nf
+		commit.Entrophy = entropy(locModified)
+	}
+
+	if git.EntropyWindow > 0 {
+		commit.HistoryEntrophy = state.historyEntropy(locModified, unixTimeStamp, git.EntropyWindow)
 	}
 }
 
-//Commits retuns all the commits of repoDir
+//Commits retuns the commits of repoDir ingested after lastIngestedCommit.
+//Without lastIngestedCommit, the watermark stored by the DBAdaptor, if any,
+//is used and the history is ingested from the start when there is none.
+//The metrics of the new commits account for the whole history. With a
+//DBAdaptor, the fixes to link include the ones ingested by the previous
+//runs but not linked since, see SaveLinked. With AllRefs, the tips of
+//the refs are stored along with the metric state so that the next run skips
+//the commits reachable from any of them. It fails when git does
 func (git *CMD) Commits(
 	repoDir string,
 	repoName string,
 	lastIngestedCommit string,
 	workingDir string,
-	repositoryID int) ([]*pogo.Commit, []*pogo.Commit) {
+	repositoryID int) ([]*pogo.Commit, []*pogo.Commit, error) {
+
+	return git.ingest(repoDir, repoName, lastIngestedCommit, workingDir, repositoryID, true)
+}
+
+//Ingest syncs the commits of repoDir ingested after lastIngestedCommit, as
+//Commits does, and returns the fixes to link only. The other commits are
+//dropped once synced, but with MergeBranch which needs them all
+func (git *CMD) Ingest(
+	repoDir string,
+	repoName string,
+	lastIngestedCommit string,
+	workingDir string,
+	repositoryID int) ([]*pogo.Commit, error) {
 
-	var cmdOut []byte
-	var err error
+	_, fixes, err := git.ingest(repoDir, repoName, lastIngestedCommit, workingDir, repositoryID, false)
+
+	return fixes, err
+}
+
+//ingest implements Commits and Ingest, keeping all the commits or not
+func (git *CMD) ingest(
+	repoDir string,
+	repoName string,
+	lastIngestedCommit string,
+	workingDir string,
+	repositoryID int,
+	keep bool) ([]*pogo.Commit, []*pogo.Commit, error) {
+
+	repoPath := workingDir + repoName
 
 	if repoDir != workingDir {
-		fmt.Println("workingDir + repoName", workingDir+repoName)
-		if _, err = os.Stat(workingDir + repoName); err != nil {
-			git.cloneRepo(repoDir+repoName, workingDir+repoName, true)
+		fmt.Println("workingDir + repoName", repoPath)
+		if _, err := os.Stat(repoPath); err != nil {
+			if err = git.cloneRepo(repoDir+repoName, repoPath, true); err != nil {
+				return nil, nil, err
+			}
+		} else if err = git.Backend.Fetch(context.Background(), repoPath); err != nil {
+			return nil, nil, err
 		}
 	}
 
-	// Log file already exists
-	if _, err = os.Stat(workingDir + "logs/" + repoName + ".log"); err == nil {
+	if lastIngestedCommit == "" && git.DBAdaptor != nil {
+		lastIngestedCommit = git.DBAdaptor.Watermark(repositoryID)
+	}
 
-		fmt.Println("Found file", workingDir+"/logs/"+repoName+".log")
-		cmdOut, err = ioutil.ReadFile(workingDir + "/logs/" + repoName + ".log")
+	head, err := git.Backend.RevParse(context.Background(), repoPath, "HEAD")
+	if err != nil {
+		return nil, nil, err
+	}
 
-		if err != nil {
-			panic(err)
+	logDir := workingDir + "logs/"
+	stateFile := logDir + repoName + ".state"
+
+	tips := []string(nil)
+	if git.AllRefs {
+		if tips, err = git.refTips(repoPath); err != nil {
+			return nil, nil, err
 		}
-	} else {
-		//Run git log
-		cmdArgs := []string{"log", "--numstat", "--reverse", git.logformat}
+	}
+
+	if head == lastIngestedCommit {
 
-		if lastIngestedCommit != "" {
-			cmdArgs = append(cmdArgs, fmt.Sprintf("%s..HEAD", lastIngestedCommit))
+		//Other refs may have moved while HEAD did not
+		state := loadState(stateFile, head)
+		if !git.AllRefs || (state != nil && strings.Join(state.Tips, " ") == strings.Join(tips, " ")) {
+			fmt.Println(repoName, "is up to date at", head)
+
+			unlinked := []*pogo.Commit{}
+			if state != nil && git.DBAdaptor != nil {
+				unlinked = state.unlinkedCommits(repositoryID)
+			}
+
+			return []*pogo.Commit{}, unlinked, nil
 		}
+	}
+
+	state, err := git.metricState(repoPath, logDir+repoName, lastIngestedCommit, stateFile, repositoryID)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		cmdArgs = append(cmdArgs, "> "+workingDir+"/logs/"+repoName+".log")
+	//Run git log, for the new commits only
+	revisions, logName := []string{head}, head
+	if lastIngestedCommit != "" {
+		revisions = append(revisions, "^"+lastIngestedCommit)
+		logName = lastIngestedCommit + ".." + logName
+	}
 
-		cmd := exec.Command("git", cmdArgs...)
-		cmd.Dir = workingDir
+	//All the refs are listed but the commits reachable from the tips
+	//of the previous run, which are ingested already. The log is named
+	//after the tips it lists, the refs move between runs
+	if git.AllRefs {
+		seen := state.Tips
+		if lastIngestedCommit == "" {
+			seen = nil
+		} else if len(seen) == 0 {
+			seen = []string{lastIngestedCommit}
+		}
 
-		if cmdOut, err = cmd.Output(); err != nil {
-			log.Panic("There was an error running git log command: ", err)
-			os.Exit(1)
+		revisions = []string{"--all", "--ignore-missing"}
+		for _, tip := range seen {
+			revisions = append(revisions, "^"+tip)
 		}
 
-		//Restart this we the outputed log file
-		git.Commits(repoDir, repoName, lastIngestedCommit, workingDir, repositoryID)
+		logName = fmt.Sprintf("all-%x", sha1.Sum([]byte(strings.Join(append(tips, revisions...), " "))))
+	}
 
+	logStream, err := git.openLog(repoPath, logDir+repoName+"-"+logName+git.logVariant()+".zlog", git.logArgs(revisions...)...)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	commitFiles := make(map[string]commitFile)
-	devExp := make(map[string]devExperiences)
-	commitList := strings.Split(string(cmdOut), "BUMPER_STARTPRETTY")
+	keep = keep || git.MergePolicy == MergeBranch
 
 	commits := []*pogo.Commit{}
 	trueCorrectiveCommits := []*pogo.Commit{}
-	correctiveCommits := []*pogo.Commit{}
-	totalFixReports := 0
-	syncEnable := false
-
-	if strings.Compare("", lastIngestedCommit) == 0 {
-		syncEnable = true
-	}
-
-	for index := 1; index < len(commitList); index++ {
-
-		prettyCommitSplit := strings.Split(commitList[index], "BUMPER_STOPPRETTY")
-		prettyCommit := prettyCommitSplit[0]
-		statsCommit := prettyCommitSplit[1]
-
-		prettyCommitDetails := strings.Split(prettyCommit, " BUMPER_DELIMITER2")
-
-		commit := pogo.NewCommit(
-			strings.Split(prettyCommitDetails[0], " "),
-			strings.Trim(prettyCommitDetails[1], " "),
-			strings.Trim(prettyCommitDetails[2], " "),
-			strings.Trim(prettyCommitDetails[3], " "),
-			strings.Trim(prettyCommitDetails[4], " "),
-			strings.Trim(prettyCommitDetails[5], " "),
-			strings.Trim(prettyCommitDetails[6], " "),
-			`@fix(ed\()?( )?([a-zA-Z0-9]+-[0-9]+)`,
-			`@review\(([a-z,]+)\)`,
-			true,
-			repositoryID)
-
-		stats := strings.Split(statsCommit, "\n")
-		git.commitStats(
-			stats,
-			commitFiles,
-			devExp,
-			commit.AuthorEmail,
-			commit.AuthorDateUnixTimestamp,
-			commit)
+	totalCommits, correctiveCommits, totalFixReports := 0, 0, 0
+
+	commitStream, errs := git.StreamCommits(logStream, repoPath, repositoryID, state)
+
+	//Syncing happens as commits are parsed, a slow database slows the
+	//parsing down. With MergeBranch, the commits are synced once the
+	//merges gave their reports to the commits of their branches
+	for commit := range commitStream {
 
 		if _, present := commit.Classification["corrective"]; present {
 			if commit.Classification["corrective"] == 100.0 && len(commit.Classification) == 1 {
 				trueCorrectiveCommits = append(trueCorrectiveCommits, commit)
 			} else if commit.Classification["corrective"] > 0.0 {
-				correctiveCommits = append(correctiveCommits, commit)
+				correctiveCommits++
 			}
 		}
 
-		if git.DBAdaptor != nil && syncEnable {
-
+		if git.DBAdaptor != nil && git.MergePolicy != MergeBranch {
 			git.DBAdaptor.SyncCommit(commit)
-		} else {
-			fmt.Println("Skipping", commit.CommitHash)
 		}
 
-		if strings.Compare(commit.CommitHash, lastIngestedCommit) == 0 {
-			syncEnable = true
+		totalCommits++
+		totalFixReports += len(commit.FixReportIDs)
+		if keep {
+			commits = append(commits, commit)
 		}
+	}
 
-		totalFixReports += len(commit.FixReportIDs)
-		commits = append(commits, commit)
+	if err = <-errs; err != nil {
+		logStream.Close()
+		return nil, nil, errors.New("parsing the git log of " + repoName + ": " + err.Error())
+	}
+
+	if err = logStream.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	if git.MergePolicy == MergeBranch {
+		trueCorrectiveCommits = append(trueCorrectiveCommits, git.branchFixes(repoPath, commits)...)
+
+		if git.DBAdaptor != nil {
+			for _, commit := range commits {
+				git.DBAdaptor.SyncCommit(commit)
+			}
+		}
+	}
+
+	//Everything up to head is ingested, the next run starts from there.
+	//The fixes are linked once SaveLinked says so
+	if git.DBAdaptor != nil {
+		trueCorrectiveCommits = append(state.unlinkedCommits(repositoryID), trueCorrectiveCommits...)
+
+		state.Hash = head
+		state.Tips = tips
+		state.setUnlinked(trueCorrectiveCommits)
+		if err = state.save(stateFile); err != nil {
+			fmt.Println("Could not save the metric state", stateFile, err.Error())
+		}
+		git.DBAdaptor.SyncWatermark(repositoryID, head)
 	}
 
-	fmt.Println("Commits:", len(commits))
+	fmt.Println("Commits:", totalCommits)
 	fmt.Println("Pure Corrective Commits:", len(trueCorrectiveCommits))
-	fmt.Println("Corrective Commits:", len(correctiveCommits))
+	fmt.Println("Corrective Commits:", correctiveCommits)
 	fmt.Println("Reports closed:", totalFixReports)
 
-	return commits, trueCorrectiveCommits
+	return commits, trueCorrectiveCommits, nil
 }
 
-//clone a repo
-func (git *CMD) cloneRepo(from string, to string, bare bool) {
+//refTips returns the sorted hashes of the commits the refs of repoPath point to
+func (git *CMD) refTips(repoPath string) ([]string, error) {
 
-	fmt.Println("Copying from", from, "to", to, "with bare =", bare)
+	stream, err := git.Backend.Log(context.Background(), repoPath, "--all", "--no-walk", "--format=%H")
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := ioutil.ReadAll(stream)
+	if err == nil {
+		err = stream.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tips := strings.Fields(string(out))
+	sort.Strings(tips)
+
+	return tips, nil
+}
+
+//SaveLinked records which of fixes, returned by Commits, are linked. The
+//others, i.e. the ones of interrupted or timed out jobs, are returned
+//again by the next call to Commits
+func (git *CMD) SaveLinked(repoName string, workingDir string, fixes []*pogo.Commit) {
 
-	cmdArgs := []string{"git", "clone"}
+	if git.DBAdaptor == nil {
+		return
+	}
+
+	stateFile := workingDir + "logs/" + repoName + ".state"
+
+	state := loadState(stateFile, "")
+	if state == nil {
+		return
+	}
+
+	state.removeLinked(fixes)
+	if err := state.save(stateFile); err != nil {
+		fmt.Println("Could not save the metric state", stateFile, err.Error())
+	}
+}
+
+//metricState returns the metric state of the history up to lastIngestedCommit.
+//It is read from stateFile if it was stored by the previous run and is rebuilt
+//by replaying the history, without syncing anything, otherwise
+func (git *CMD) metricState(repoPath string, logPrefix string, lastIngestedCommit string, stateFile string, repositoryID int) (*MetricState, error) {
+
+	if lastIngestedCommit == "" {
+		return NewMetricState(), nil
+	}
 
-	if bare {
-		cmdArgs = append(cmdArgs, "--bare")
+	if state := loadState(stateFile, lastIngestedCommit); state != nil {
+		fmt.Println("Found metric state", stateFile)
+		return state, nil
 	}
 
-	/*
-		core.preloadindex
-		Enable parallel index preload for operations like git diff
-		This can speed up operations like git diff and git status
-		especially on filesystems like NFS that have weak caching semantics
-		and thus relatively high IO latencies. With this set to true,
-		git will do the index comparison to the filesystem data in parallel,
-		allowing overlapping IO's.
-	*/
-	cmdArgs = append(cmdArgs, from, to, "&& cd", from, "&& git config core.preloadindex true")
+	fmt.Println("Rebuilding metric state up to", lastIngestedCommit)
 
-	cmd := exec.Command("bash", "-c", strings.Join(cmdArgs, " "))
-	_, err := cmd.CombinedOutput()
+	state := NewMetricState()
 
+	logStream, err := git.openLog(repoPath, logPrefix+"-"+lastIngestedCommit+git.logVariant()+".zlog", git.logArgs(lastIngestedCommit)...)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	commitStream, errs := git.StreamCommits(logStream, repoPath, repositoryID, state)
+	for range commitStream {
+	}
+
+	if err = <-errs; err != nil {
+		logStream.Close()
+		return nil, errors.New("parsing the git log up to " + lastIngestedCommit + ": " + err.Error())
+	}
+
+	return state, logStream.Close()
+}
+
+//logArgs returns the arguments of git log listing revisions for StreamCommits.
+//The files are NUL separated, .zlog files, with renames detected
+func (git *CMD) logArgs(revisions ...string) []string {
+
+	args := []string{"-z", "--raw", "--numstat", "-M", "--reverse"}
+
+	if git.FirstParent {
+		args = append(args, "--first-parent")
+	}
+
+	//Merges have no stats otherwise
+	if git.MergePolicy == MergeFirstParent {
+		args = append(args, "--diff-merges=first-parent")
+	}
+
+	return append(append(args, git.logformat), revisions...)
+}
+
+//logVariant tells apart the logs of the same revisions
+//listed with other options, empty for the default ones
+func (git *CMD) logVariant() string {
+
+	variant := ""
+
+	if git.FirstParent {
+		variant += "_first-parent"
+	}
+
+	if git.MergePolicy == MergeFirstParent {
+		variant += "_merges"
+	}
+
+	return variant
+}
+
+//openLog streams the log cached in logFile or, if there is none yet,
+//the output of git log in repoDir while caching it in logFile
+func (git *CMD) openLog(repoDir string, logFile string, args ...string) (io.ReadCloser, error) {
+
+	// Log file already exists
+	if _, err := os.Stat(logFile); err == nil {
+		fmt.Println("Found file", logFile)
+		return os.Open(logFile)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(logFile), 0755); err != nil {
+		return nil, err
+	}
+
+	stream, err := git.Backend.Log(context.Background(), repoDir, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	//The log is written next to logFile and only moved there once
+	//complete, so an interrupted run never leaves a truncated log
+	file, err := os.Create(logFile + ".tmp")
+	if err != nil {
+		stream.Close()
+		return nil, err
+	}
+
+	return &cachingLog{Reader: io.TeeReader(stream, file), stream: stream, file: file, path: logFile}, nil
+}
+
+//cachingLog is a git log stream copied to a file as it is read
+type cachingLog struct {
+	io.Reader
+	stream io.ReadCloser
+	file   *os.File
+	path   string
+}
+
+//Close closes the stream and keeps the copy if git succeeded
+func (cached *cachingLog) Close() error {
+
+	err := cached.stream.Close()
+
+	if closeErr := cached.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(cached.file.Name())
+		return err
+	}
+
+	return os.Rename(cached.file.Name(), cached.path)
+}
+
+//clone a repo
+func (git *CMD) cloneRepo(from string, to string, bare bool) error {
+
+	fmt.Println("Copying from", from, "to", to, "with bare =", bare)
+
+	if err := git.Backend.Clone(context.Background(), from, to, bare); err != nil {
+		return err
 	}
 
 	fmt.Println("Copy from", from, "to", to, " done.")
+
+	return nil
 }
 
-type commitChan struct {
+//linkJob is the linking of the IDth corrective commit
+type linkJob struct {
 	Commit *pogo.Commit
 	ID     int
 }
 
-//LinkCorrectiveCommits tries to link fault commits with their fixes
+//linkResult is the outcome of the linking of a corrective commit
+type linkResult struct {
+	ID int
+	//bug in hash -> introducted by hashes
+	Links map[string][]string
+	//bug in hash -> lines of the fixes blamed on it
+	Provenances map[string][]pogo.FixProvenance
+	Suspicious  []Suspicion
+	Err         error
+}
+
+//LinkCorrectiveCommits tries to link fault commits with their fixes.
+//It returns the candidates flagged or discarded by the time filter
 func (git *CMD) LinkCorrectiveCommits(
 	correctiveCommits []*pogo.Commit,
 	allCommits []*pogo.Commit, repoDir string,
-	logDir string, repoID int) {
+	logDir string, repoID int) []Suspicion {
 
-	//Parallel stuff
-	jobs := make(chan commitChan, 15000) //len(correctiveCommits))
-	results := make(chan map[string][]string)
-	wg := sync.WaitGroup{}
-	wg.Add(git.Threads)
+	//Without cancellation, only timed out jobs can fail and they are skipped
+	suspicious, _ := git.LinkCorrectiveCommitsContext(context.Background(),
+		correctiveCommits, allCommits, repoDir, logDir, repoID)
 
-	//Create git.Threads copies of the repo
-	for w := 0; w < git.Threads; w++ {
-		go func(workerId int) {
+	return suspicious
+}
 
-			git.cloneRepo(repoDir, repoDir+"-bare-"+strconv.Itoa(workerId), true)
-			wg.Done()
-		}(w)
+//LinkCorrectiveCommitsContext links fault commits with their fixes using
+//up to git.Threads workers, each job being bounded by git.LinkTimeout.
+//Once ctx is cancelled, no job is started and the running ones are killed,
+//the links found by the completed jobs are still applied and ctx's error is
+//returned. Jobs are merged in the order of correctiveCommits so a run is
+//deterministic whatever the workers' scheduling
+func (git *CMD) LinkCorrectiveCommitsContext(
+	ctx context.Context,
+	correctiveCommits []*pogo.Commit,
+	allCommits []*pogo.Commit, repoDir string,
+	logDir string, repoID int) ([]Suspicion, error) {
+
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		panic(err)
 	}
-	wg.Wait()
 
-	//Contains the result of the linking operations
-	//bug in hash -> introducted by hashes
-	linkedCommits := make(map[string][]string)
+	total := len(correctiveCommits)
+	if total == 0 {
+		return nil, ctx.Err()
+	}
 
-	//create worker to operate parrallel blames & annotates
-	for w := 0; w < git.Threads; w++ {
-		go git.linkerWorker(jobs, repoDir+"-bare-"+strconv.Itoa(w), results, w, 15000, logDir, repoID)
-		fmt.Println("creating worker", w)
+	threads := git.Threads
+	if threads > total {
+		threads = total
+	}
+	if threads < 1 {
+		threads = 1
 	}
 
-	//Feed our bug fixes to the workers
-	for i := 0; i < 15000; i++ { //len(correctiveCommits); i++ {
-		jobs <- commitChan{correctiveCommits[i], i}
+	//Skipped merges can't introduce bugs
+	merges := make(map[string]struct{})
+	for _, commit := range allCommits {
+		if commit.IsMerge() && git.skipsMerges() {
+			merges[commit.CommitHash] = struct{}{}
+		}
 	}
-	close(jobs)
 
-	for i := 0; i < 14000; i++ { //len(correctiveCommits); i++ {
-		fmt.Println("received", i)
+	jobs := make(chan linkJob)
+	results := make(chan *linkResult, threads)
+
+	//Feed our bug fixes to the workers until cancelled
+	go func() {
+		defer close(jobs)
+		for i, commit := range correctiveCommits {
+			select {
+			case jobs <- linkJob{commit, i}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
 
-		for k, v := range <-results {
-			//response for a timeout is null
-			if v != nil {
-				linkedCommits[k] = append(linkedCommits[k], v...)
+	//create worker to operate parrallel blames & annotates. Diffs
+	//and blames only read the repository, workers share it
+	wg := sync.WaitGroup{}
+	wg.Add(threads)
+	for w := 0; w < threads; w++ {
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				results <- git.linkCommit(ctx, job, merges, repoDir, logDir, repoID)
 			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	ordered := make([]*linkResult, total)
+	done, failed := 0, 0
+
+	for result := range results {
+
+		ordered[result.ID] = result
+		done++
+
+		if result.Err != nil {
+			failed++
+			fmt.Println("linking", correctiveCommits[result.ID].CommitHash, "failed:", result.Err.Error())
 		}
+
+		fmt.Println("linked", done, "/", total, strconv.FormatFloat(float64(done)/float64(total)*100, 'f', 1, 64)+"%", "("+strconv.Itoa(failed), "failed)")
+	}
+
+	//Contains the result of the linking operations
+	//bug in hash -> introducted by hashes
+	linkedCommits := make(map[string][]string)
+	provenances := make(map[string][]pogo.FixProvenance)
+	suspicious := []Suspicion{}
+
+	for _, result := range ordered {
+		if result == nil || result.Err != nil {
+			continue
+		}
+
+		for buggyCommit, fixHashes := range result.Links {
+			linkedCommits[buggyCommit] = append(linkedCommits[buggyCommit], fixHashes...)
+			provenances[buggyCommit] = append(provenances[buggyCommit], result.Provenances[buggyCommit]...)
+		}
+		suspicious = append(suspicious, result.Suspicious...)
 	}
 
 	for _, commit := range allCommits {
 		if _, present := linkedCommits[commit.CommitHash]; present {
 			commit.ContainsBug = true
 			commit.FixHashes = linkedCommits[commit.CommitHash]
+			commit.FixProvenances = provenances[commit.CommitHash]
 			if git.DBAdaptor != nil {
 				git.DBAdaptor.IsBuggy(commit, repoID)
 			}
+			delete(linkedCommits, commit.CommitHash)
+		}
+	}
+
+	//On incremental runs, new fixes also point to commits
+	//ingested by previous runs
+	if git.DBAdaptor != nil {
+		for hash, fixHashes := range linkedCommits {
+			git.DBAdaptor.IsBuggy(&pogo.Commit{
+				CommitHash:     hash,
+				RepositoryID:   repoID,
+				ContainsBug:    true,
+				FixHashes:      fixHashes,
+				FixProvenances: provenances[hash],
+			}, repoID)
 		}
 	}
 
-	//Delete the repos, no need to wait for complete deletion here
-	for w := 0; w < git.Threads; w++ {
-		go func(workerId int) {
+	return suspicious, ctx.Err()
+}
 
-			cmd := exec.Command("rm", "-r", repoDir+"-bare-"+strconv.Itoa(workerId))
-			_, err := cmd.CombinedOutput()
+//linkCommit blames the corrective commit of job while fetching the
+//reports it fixes. The git commands are killed when the job lasts
+//more than git.LinkTimeout, if any, or when ctx is cancelled. The
+//merges can't be blamed for the bug
+func (git *CMD) linkCommit(ctx context.Context, job linkJob, merges map[string]struct{}, repoDir string, logDir string, repoID int) *linkResult {
 
-			if err != nil {
-				panic(err)
-			}
-			fmt.Println("deleting repo", repoDir+"-bare-"+strconv.Itoa(workerId))
-			wg.Done()
-		}(w)
+	commit := job.Commit
+
+	var jobCtx context.Context
+	var cancel context.CancelFunc
+
+	if git.LinkTimeout > 0 {
+		jobCtx, cancel = context.WithTimeout(ctx, git.LinkTimeout)
+	} else {
+		jobCtx, cancel = context.WithCancel(ctx)
 	}
+	defer cancel()
 
-}
+	wg := sync.WaitGroup{}
+	wg.Add(1)
 
-//linkerWorker is a worker that performs git blame/annotate and
-//updated the linkedCommit map
-func (git *CMD) linkerWorker(
-	correctiveCommits <-chan commitChan,
-	repoDir string,
-	results chan map[string][]string,
-	id int,
-	total int,
-	logDir string,
-	repoID int) {
+	var bugIntroducingChanges map[string][]blameLine
 
-	for correctiveCommit := range correctiveCommits {
+	//First thread to blame the corrective commit, its git commands are killed with jobCtx
+	go func() {
+		defer wg.Done()
+		regionChunks := git.getModifiedRegions(jobCtx, commit, repoDir, logDir)
+		bugIntroducingChanges = git.annotate(jobCtx, regionChunks, commit, repoDir, logDir)
+	}()
 
-		wg := sync.WaitGroup{}
-		wg.Add(2)
+	//Second thread to fetch fixed reports. A fetch can't be interrupted,
+	//the thread is abandoned when jobCtx is done
+	fetched := make(chan []pogo.Report, 1)
+	go func() {
+		fetched <- git.fetchReports(jobCtx, commit)
+	}()
 
-		linkedCommits := make(map[string][]string)
+	select {
+	case reports := <-fetched:
+		commit.FixReports = append(commit.FixReports, reports...)
 
-		//First thread to blame the corrective commit
-		go func(localWg *sync.WaitGroup, commit *pogo.Commit) {
+		//Do we have a db adapotor sync reports ?
+		if git.DBAdaptor != nil {
+			git.DBAdaptor.SyncReports(commit.FixReports, commit.RepositoryID, commit.CommitHash)
+		}
+	case <-jobCtx.Done():
+	}
 
-			regionChunks := git.getModifiedRegions(commit, repoDir, logDir)
-			bugIntroducingChanges := git.annotate(regionChunks, commit, repoDir, logDir)
+	wg.Wait()
 
-			for buggyCommit := range bugIntroducingChanges {
+	if err := jobCtx.Err(); err != nil {
+		return &linkResult{ID: job.ID, Err: err}
+	}
 
-				linkedCommits[buggyCommit] = append(linkedCommits[buggyCommit], commit.CommitHash)
-			}
-			commit.Linked = true
-			if git.DBAdaptor != nil {
-				git.DBAdaptor.IsLinked(commit, repoID)
-			}
-			localWg.Done()
-		}(&wg, correctiveCommit.Commit)
-
-		//Second thread to fetch fixed reports
-		go func(localWg *sync.WaitGroup, commit *pogo.Commit) {
-
-			//Do we have a report linker ?
-			if git.ReportLinker != nil {
-
-				var pogoReport pogo.Report
-				var err error
-
-				//Ids are extracted at commit instantiation
-				for _, reportID := range commit.FixReportIDs {
-					fmt.Println("fetching report", git.ReportLinker.DBName()+"_"+reportID)
-					//Do we have that report in cache ?
-					if report := gcache.GetCacheInstance().
-						Fetch("report", git.ReportLinker.DBName()+"_"+strings.Replace(reportID, "ACE-", "", 1)); report != nil {
-						fmt.Println("Cache hit report")
-						pogoReport = &jira.Report{ReportAttributes: report.(pogo.ReportAttributes)}
-					} else {
-						pogoReport, err = git.ReportLinker.Fetch(reportID)
-					}
-
-					if err != nil {
-						fmt.Println(err.Error(), correctiveCommit, reportID)
-					} else {
-						commit.FixReports = append(commit.FixReports, pogoReport)
-					}
+	for hash := range bugIntroducingChanges {
+		if _, merge := merges[hash]; merge {
+			delete(bugIntroducingChanges, hash)
+		}
+	}
 
-				}
-			}
+	commit.Linked = true
+	if git.DBAdaptor != nil {
+		git.DBAdaptor.IsLinked(commit, repoID)
+	}
 
-			//Do we have a db adapotor sync reports ?
-			if git.DBAdaptor != nil {
-				git.DBAdaptor.SyncReports(commit.FixReports, commit.RepositoryID, commit.CommitHash)
-			}
+	//The candidates are filtered once the fixed reports are known
+	accepted, suspicious := git.timeFilter(commit, bugIntroducingChanges)
 
-			localWg.Done()
-		}(&wg, correctiveCommit.Commit)
+	linkedCommits := make(map[string][]string)
+	provenances := make(map[string][]pogo.FixProvenance)
 
-		if waitTimeout(&wg, time.Hour) {
-			fmt.Println("worker", id, "/", git.Threads, "timed out", correctiveCommit.ID, "/", total, float64(correctiveCommit.ID)/float64(total)*100, "%")
-			results <- nil
-		} else {
-			results <- linkedCommits
-			fmt.Println("worker", id, "/", git.Threads, "finished job", correctiveCommit.ID, "/", total, float64(correctiveCommit.ID)/float64(total)*100, "%")
+	for buggyCommit, lines := range accepted {
+
+		linkedCommits[buggyCommit] = append(linkedCommits[buggyCommit], commit.CommitHash)
+
+		for _, line := range lines {
+			provenances[buggyCommit] = append(provenances[buggyCommit], pogo.FixProvenance{
+				FixHash:      commit.CommitHash,
+				File:         line.File,
+				Line:         line.Line,
+				Content:      line.Content,
+				OriginalFile: line.OriginalFile,
+				OriginalLine: line.OriginalLine,
+				SZZ:          git.SZZ,
+			})
 		}
 	}
+
+	return &linkResult{job.ID, linkedCommits, provenances, suspicious, nil}
 }
 
-func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
-	c := make(chan struct{})
-	go func() {
-		defer close(c)
-		wg.Wait()
-	}()
-	select {
-	case <-c:
-		return false // completed normally
-	case <-time.After(timeout):
-		return true // timed out
+//fetchReports returns the reports fixed by commit using the report
+//linker. It stops fetching them once ctx is done
+func (git *CMD) fetchReports(ctx context.Context, commit *pogo.Commit) []pogo.Report {
+
+	reports := []pogo.Report{}
+
+	//Do we have a report linker ?
+	if git.ReportLinker == nil {
+		return reports
+	}
+
+	//Ids are extracted at commit instantiation
+	for _, reportID := range commit.FixReportIDs {
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		var pogoReport pogo.Report
+		var err error
+
+		fmt.Println("fetching report", git.ReportLinker.DBName()+"_"+reportID)
+		//Do we have that report in cache ?
+		//Reports are cached by their number, i.e. 1234 for ACE-1234 or bug 1234
+		reportNumber := reportID[strings.LastIndexAny(reportID, " #-")+1:]
+		if report := gcache.GetCacheInstance().
+			Fetch("report", git.ReportLinker.DBName()+"_"+reportNumber); report != nil {
+			fmt.Println("Cache hit report")
+			pogoReport = git.ReportLinker.Cached(report.(pogo.ReportAttributes))
+		} else {
+			pogoReport, err = git.ReportLinker.Fetch(reportID)
+		}
+
+		if err != nil {
+			fmt.Println(err.Error(), commit.CommitHash, reportID)
+		} else {
+			reports = append(reports, pogoReport)
+		}
 	}
+
+	return reports
 }
 
 //  getModifiedRegions returns the list of regions that were modified/deleted between this commit and its ancester.
 // a region is simply the file and the loc in it that were modified.
-func (git *CMD) getModifiedRegions(commit *pogo.Commit, repoDir string, logDir string) map[string][]string {
+func (git *CMD) getModifiedRegions(ctx context.Context, commit *pogo.Commit, repoDir string, logDir string) map[string][]string {
 
-	var diff []byte
-	var filesModifiedOUT []byte
-	var err error
-	var cmdArgs []string
+	parent := git.parentRevision(ctx, commit, repoDir)
+	diffID := "unified_diff_" + parent + commit.CommitHash
 
-	diffID := "diff_" + commit.CommitHash + "^" + commit.CommitHash
-	filesModifiedDiffID := "file_modified_diff_" + commit.CommitHash + "^" + commit.CommitHash
+	diff := git.cachedOutput(ctx, "unified_diff", diffID, logDir, func() ([]byte, error) {
+		return git.Backend.Diff(ctx, repoDir,
+			"--unified=0", "--src-prefix=a/", "--dst-prefix=b/",
+			parent, commit.CommitHash, "--")
+	})
 
-	if cachedDiffed := gcache.GetCacheInstance().
-		Fetch("diff", diffID); cachedDiffed != nil {
-		diff = cachedDiffed.([]byte)
-	} else {
-		cmdArgs = []string{
-			"git",
-			"diff",
-			commit.CommitHash + "^",
-			commit.CommitHash,
-			"--unified=0",
-			" | while",
-			"read; do echo \":BUMPER_DELIMITER_START:$REPLY:BUMPER_DELIMITER:\"; done",
-			"> " + logDir + diffID,
-			"&& cat " + logDir + diffID,
-		}
-
-		cmd := exec.Command("bash", "-c", strings.Join(cmdArgs, " "))
-		cmd.Dir = repoDir
-
-		if diff, err = cmd.CombinedOutput(); err != nil {
-			log.Panic("There was an error running git diff command: ", err,
-				"--- bash ", "-c ", strings.Join(cmdArgs, " "), "at", repoDir, string(diff))
-
-			//write an empty file so we don't wait here ever again
-			exec.Command("bash", "-c", "touch "+logDir+diffID).Output()
-			gcache.GetCacheInstance().
-				Put("diff", diffID, []byte{})
-		} else {
+	attributes := git.attributes(ctx, repoDir)
 
-			gcache.GetCacheInstance().
-				Put("diff", diffID, diff)
-		}
+	return git.extractRegions(string(diff), func(file string) classifier.FileType {
+		return git.fileType(ctx, repoDir, parent, file, attributes)
+	})
+}
+
+//attributes returns the linguist attributes of the .gitattributes
+//file at the head of the repository, once per repository
+func (git *CMD) attributes(ctx context.Context, repoDir string) *classifier.Attributes {
+
+	if cached := gcache.GetCacheInstance().Fetch("attributes", repoDir); cached != nil {
+		return cached.(*classifier.Attributes)
 	}
 
-	if cachedDiffed := gcache.GetCacheInstance().
-		Fetch("file_modified_diff", filesModifiedDiffID); cachedDiffed != nil {
-		filesModifiedOUT = cachedDiffed.([]byte)
-	} else {
-		nameOnlyArgs := []string{
-			"git",
-			"diff",
-			commit.CommitHash + "^",
-			commit.CommitHash,
-			"--name-only",
-			"> " + logDir + filesModifiedDiffID,
-			"&& cat " + logDir + filesModifiedDiffID,
-		}
-
-		cmd := exec.Command("bash", "-c", strings.Join(nameOnlyArgs, " "))
-		cmd.Dir = repoDir
-
-		// get the files modified -> use this to validate if we have arrived at a new file
-		// when grepping for the specific lines changed.
-		if filesModifiedOUT, err = cmd.CombinedOutput(); err != nil {
-			log.Println("There was an error running git diff command: ", err,
-				"--- git ", strings.Join(nameOnlyArgs, " "), " at", repoDir, "previous command was",
-				"--- bash ", "-c ", strings.Join(cmdArgs, " "), " at", repoDir, string(filesModifiedOUT))
-
-			//write an empty file so we don't wait here ever again
-			exec.Command("bash", "-c", "touch "+logDir+filesModifiedDiffID).Output()
-			gcache.GetCacheInstance().
-				Put("file_modified_diff", filesModifiedDiffID, []byte{})
-		} else {
+	//Most repositories don't have one
+	content, _ := git.Backend.Show(ctx, repoDir, "HEAD:.gitattributes")
+	attributes := classifier.ParseAttributes(string(content))
 
-			gcache.GetCacheInstance().
-				Put("file_modified_diff", filesModifiedDiffID, filesModifiedOUT)
-		}
+	gcache.GetCacheInstance().Put("attributes", repoDir, attributes)
+
+	return attributes
+}
 
+//fileType returns the type of file at rev. Its first line is only
+//read for the shebang of files without extension
+func (git *CMD) fileType(ctx context.Context, repoDir string, rev string, file string, attributes *classifier.Attributes) classifier.FileType {
+
+	head := ""
+
+	if filepath.Ext(file) == "" {
+		content, _ := git.Backend.Show(ctx, repoDir, rev+":"+file)
+		head = strings.SplitN(string(content), "\n", 2)[0]
 	}
 
-	filesModified := strings.Split(strings.Replace(string(filesModifiedOUT), "b'", "", -1), "\n")
+	return classifier.GetInstance().FileType(file, head, attributes)
+}
 
-	if err != nil {
-		return make(map[string][]string)
+//cachedOutput returns the output of run, cached in memory and in logDir under id.
+//A failing run is cached as an empty output so we don't wait here ever again,
+//unless it failed because ctx is done
+func (git *CMD) cachedOutput(ctx context.Context, store string, id string, logDir string, run func() ([]byte, error)) []byte {
+
+	if cached := gcache.GetCacheInstance().Fetch(store, id); cached != nil {
+		return cached.([]byte)
 	}
 
-	return git.extractRegions(string(diff), filesModified)
+	out, err := run()
+	if err != nil && ctx.Err() != nil {
+		return []byte{}
+	} else if err != nil {
+		fmt.Println("There was an error running git command:", err.Error())
+		out = []byte{}
+	}
+
+	if err = ioutil.WriteFile(logDir+id, out, 0644); err != nil {
+		fmt.Println("Could not cache", id, "in", logDir, err.Error())
+	}
+
+	gcache.GetCacheInstance().Put(store, id, out)
+
+	return out
 }
 
 //  extractRegions returns a dict of file -> list of line numbers modified. helper function for getModifiedRegions
@@ -693,114 +1114,113 @@ func (git *CMD) getModifiedRegions(commit *pogo.Commit, repoDir string, logDir s
 //  if a file was merely deleted, then there was no chunk or region changed but we do capture the file.
 //  however, we do not assume this is a location of a buy
 //  modified means modified or deleted -- not added! We assume are lines of code modified is the location of a bug.
-func (git *CMD) extractRegions(diff string, filesModified []string) map[string][]string {
+//  fileType tells which files are code.
+func (git *CMD) extractRegions(diff string, fileType func(file string) classifier.FileType) map[string][]string {
 
 	var regionDiff = make(map[string][]string)
 
-	for _, file := range filesModified {
-
-		// weed out bad files/binary files/etc
-		if file != "'" && file != "" {
-			fileInfos := strings.Split(file, ".")
+	//file is the current file in the parent commit, empty for
+	//added, binary and non-code files, of language
+	file, language := "", ""
+	//lines left in the current hunk, for the parent and the commit
+	oldLeft, newLeft := 0, 0
+	//current line in the parent commit
+	currentLine := 0
+	//lines deleted and added by the current hunk
+	deleted, added := []hunkLine{}, []hunkLine{}
+
+	for _, line := range strings.Split(diff, "\n") {
+
+		//Inside a hunk, lines are counted so code lines looking
+		//like headers (i.e. a deleted "-- comment") are never mistaken
+		if oldLeft > 0 || newLeft > 0 {
+
+			switch {
+			case strings.HasPrefix(line, "-"):
+				// this line modifies or deletes a line of code
+				deleted = append(deleted, hunkLine{currentLine, line[1:]})
+				currentLine++
+				oldLeft--
+			case strings.HasPrefix(line, "+"):
+				added = append(added, hunkLine{0, line[1:]})
+				newLeft--
+			case strings.HasPrefix(line, "\\"):
+				// \ No newline at end of file
+			default:
+				oldLeft--
+				newLeft--
+				currentLine++
+			}
 
-			// get extentions
-			if len(fileInfos) > 1 {
-				fileExt := fileInfos[1]
+			if oldLeft <= 0 && newLeft <= 0 && file != "" {
+				regionDiff[file] = append(regionDiff[file], git.hunkRegions(language, deleted, added)...)
+			}
 
-				// ensure these source code file endings
-				if classifier.GetInstance().IsCodeExtention(fileExt) {
+			continue
+		}
 
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			file = ""
+		case strings.HasPrefix(line, "--- "):
+			file = ""
+			if path := unquotePath(strings.TrimPrefix(line, "--- ")); strings.HasPrefix(path, "a/") {
+				// ensure these are source code files, tests being optional
+				if codeType := fileType(path[2:]); codeType.IsCode() &&
+					!(git.ExcludeTests && codeType.Category == classifier.CategoryTest) {
+
+					file, language = path[2:], codeType.Language
 					regionDiff[file] = []string{}
 				}
 			}
+		case strings.HasPrefix(line, "@@ "):
+			// @@ -101,30 +202,33 @@ we only care about where the modification started
+			// and the lengths, so we know when the hunk ends
+			currentLine, oldLeft = parseRange(line, "-")
+			_, newLeft = parseRange(line, "+")
+			deleted, added = []hunkLine{}, []hunkLine{}
 		}
 	}
 
-	//split all the different regions
-	var regions = strings.Split(diff, "diff --git")[1:]
+	return regionDiff
+}
 
-	for _, region := range regions {
+//parseRange parses the start and the length of the range
+//prefixed by sign in a hunk header like @@ -101,30 +202,33 @@
+func parseRange(header string, sign string) (int, int) {
 
-		//We begin by splitting on the beginning of double at characters, which gives us an array looking like this:
-		// [file info, line info {double at characters} modified code]
-		initialChunks := strings.Split(region, ":BUMPER_DELIMITER_START:@@")
+	for _, field := range strings.Fields(header) {
 
-		//if a binary file it doesn't display the lines modified (a.k.a the 'line info {double at characters} modified code' part)
-		if len(initialChunks) == 1 {
+		if !strings.HasPrefix(field, sign) {
 			continue
 		}
 
-		// file info is the first 'chunk', followed by the line_info {double at characters} modified code
-		fileInfo := initialChunks[0]
-		fileInfoSplit := strings.Split(fileInfo, " ")
-		//remove the 'a/ character'
-		fileName := fileInfoSplit[1][2:]
-
-		//it is possible there is a binary file being tracked or something we shouldn't care about
-		if _, present := regionDiff[fileName]; fileName == "" || !present {
-			continue
+		bounds := strings.SplitN(field[1:], ",", 2)
+		start, _ := strconv.Atoi(bounds[0])
+		length := 1
+		if len(bounds) == 2 {
+			length, _ = strconv.Atoi(bounds[1])
 		}
 
-		// Next, we must know the lines modified so that we can annotate. To do this, we must further split the chunks_initial.
-		// Specifically, we must seperate the line info from the code info. The second part of the initial chunk looks like
-		// -101,30, +202,33 {double at characters} code modified info. We can be pretty certain that the line info doesnt contain
-		// any at characters, so we can safely split the first set of doule at characters seen to divide this info up.
-
-		// Iterate through - as in one file we can multiple sections modified.
-		for _, chunk := range initialChunks[1:] {
-
-			// split only on the first occurance of the double at characters
-			codeInfoChunk := strings.Split(strings.Replace(chunk, "@@", "___%UNIQUE%___", 1), "___%UNIQUE%___")
-
-			//This now contains the -101,30 +102,30 part (info about the lines modified)
-			lineInfo := codeInfoChunk[0]
-			//This now contains the modified lines of code seperated by the delimiter we set
-			codeInfo := codeInfoChunk[1]
-
-			// As we only care about modified lines of code, we must ignore the +/additions as they do exist in previous versions
-			// and thus, we cannot even annotate them (they were added in this commit). So, we only care about the start where it was
-			// modified and we will have to study which lines where modified and keep track of them.
-
-			// remove clutter -> we only care about what line the modificatin started, first index is just empty
-			modLineInfo := strings.Split(lineInfo, " ")[1]
-			// remove clutter -> first line contains info on the class and last line irrelevant
-			modCodeInfo := strings.Split(strings.Replace(codeInfo, "\\n", "", -1), ":BUMPER_DELIMITER:")
-
-			if len(modCodeInfo) > 2 {
-				modCodeInfo = modCodeInfo[1 : len(modCodeInfo)-1]
-
-				// make sure this is legitimate. expect modified line info to start with '-'
-				if modLineInfo[0] != '-' {
-					continue
-				}
-
-				//remove comma from mod_line_info as we only care about the start of the modification
-				if strings.Index(modLineInfo, ",") != -1 {
-					modLineInfo = modLineInfo[0:strings.Index(modLineInfo, ",")]
-				}
-
-				//remove the '-' in front of the line number by abs
-				currentLine, _ := strconv.ParseFloat(modLineInfo, 64)
-				currentLine = math.Abs(currentLine)
+		return start, length
+	}
 
-				//now only use the code line changes that MODIFIES (not adds) in the diff
-				for _, section := range modCodeInfo {
+	return 0, 0
+}
 
-					// this line modifies or deletes a line of code
-					if strings.Index(section, ":BUMPER_DELIMITER_START:-") != -1 {
+//unquotePath returns a path of a diff header as is, without the
+//quotes git adds around paths containing special characters
+func unquotePath(path string) string {
 
-						regionDiff[fileName] = append(regionDiff[fileName], strconv.FormatFloat(currentLine, 'f', 0, 64))
+	path = strings.TrimSuffix(path, "\t")
 
-						// we only increment modified lines of code because those lines did NOT exist
-						// in the previous commit!
-						currentLine++
-					}
-				}
-			}
+	if strings.HasPrefix(path, "\"") {
+		if unquoted, err := strconv.Unquote(path); err == nil {
+			return unquoted
 		}
 	}
 
-	return regionDiff
+	return path
 }
 
 // annotate tracks down the origin of the deleted/modified loc in the regions dict using
@@ -809,65 +1229,24 @@ func (git *CMD) extractRegions(diff string, filesModified []string) map[string][
 // was modified. these discovered commits are identified as bug-introducing changes.
 // git blame command is set up to start looking back starting from the commit BEFORE the
 // commit that was passed in. this is because a bug MUST have occured prior to this commit.
-func (git *CMD) annotate(regionChunks map[string][]string, commit *pogo.Commit, repoDir string, logDir string) map[string]struct{} {
+// git blame follows the renames of the files, moves and copies are followed w/ regards
+// to the blame options. the blamed lines are returned by bug-introducing change.
+func (git *CMD) annotate(ctx context.Context, regionChunks map[string][]string, commit *pogo.Commit, repoDir string, logDir string) map[string][]blameLine {
 
-	bugIntroducingChanges := make(map[string]struct{})
+	bugIntroducingChanges := make(map[string][]blameLine)
 
 	for file, lines := range regionChunks {
 
+		numbers := []int{}
 		for _, line := range lines {
-
-			if line != "0" {
-
-				var buggyChanges []byte
-				var err error
-				blameID := "blame_" + line + "_" + commit.CommitHash + "_" + strings.Replace(file, "/", "--", -1)
-
-				if cachedBlame := gcache.GetCacheInstance().
-					Fetch("blame", blameID); cachedBlame != nil {
-					buggyChanges = cachedBlame.([]byte)
-				} else {
-
-					// files changed, this is used by the getLineNumbersChanged function
-					blameArgs := []string{
-						"cd",
-						repoDir,
-						"&&",
-						"git",
-						"blame", "-L" + line + ",+1",
-						commit.CommitHash + "^",
-						"-l",
-						"--",
-						"'" + file + "'",
-						"> " + logDir + blameID,
-						"&& cat " + logDir + blameID,
-					}
-
-					cmd := exec.Command("bash", "-c", strings.Join(blameArgs, " "))
-					cmd.Dir = repoDir
-
-					if buggyChanges, err = cmd.CombinedOutput(); err != nil {
-						fmt.Println("There was an error running git blame command: ", "bash -c", strings.Join(blameArgs, " "), err.Error())
-						//write an empty file so we don't wait here ever again
-						exec.Command("bash", "-c", "touch "+logDir+blameID).Output()
-						gcache.GetCacheInstance().
-							Put("blame", blameID, []byte{})
-					} else {
-						gcache.GetCacheInstance().
-							Put("blame", blameID, buggyChanges)
-					}
-
-				}
-
-				//we need to git blame with the --follow option so that it follows renames in the file, and the '-l'
-				// option gives us the complete commit hash. additionally, start looking at the commit's ancestor
-				buggyChangesString := strings.Split(string(buggyChanges), " ")[0]
-
-				if _, present := bugIntroducingChanges[buggyChangesString]; !present {
-					bugIntroducingChanges[buggyChangesString] = struct{}{}
-				}
+			if number, _ := strconv.Atoi(line); number > 0 {
+				numbers = append(numbers, number)
 			}
 		}
+
+		for _, blamed := range git.blameFile(ctx, commit, file, numbers, repoDir, logDir) {
+			bugIntroducingChanges[blamed.Hash] = append(bugIntroducingChanges[blamed.Hash], blamed)
+		}
 	}
 
 	return bugIntroducingChanges
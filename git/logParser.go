@@ -0,0 +1,253 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/mathieunls/deepchange-downloader/identity"
+	"github.com/mathieunls/deepchange-downloader/pogo"
+)
+
+//StreamBuffer is the number of parsed commits that can wait
+//for a consumer before the parsing of the log is paused
+const StreamBuffer = 128
+
+//maxRecordSize bounds the size of a single commit in the log
+const maxRecordSize = 256 * 1024 * 1024
+
+var startMarker = []byte("BUMPER_STARTPRETTY")
+
+//scanRecords is a bufio.SplitFunc returning the records of a
+//log produced with logformat, one commit per record
+func scanRecords(data []byte, atEOF bool) (int, []byte, error) {
+
+	start := bytes.Index(data, startMarker)
+	if start == -1 {
+		if atEOF {
+			return len(data), nil, nil
+		}
+		return 0, nil, nil
+	}
+
+	begin := start + len(startMarker)
+
+	//The record runs until the start of the next one
+	if next := bytes.Index(data[begin:], startMarker); next != -1 {
+		return begin + next, data[begin : begin+next], nil
+	}
+
+	if atEOF {
+		return len(data), data[begin:], nil
+	}
+
+	//Request more data
+	return 0, nil, nil
+}
+
+//numstat is a file modified by a commit, as listed by git log -z --raw --numstat
+type numstat struct {
+	Added   int
+	Deleted int
+	Path    string
+	//OldPath is the path before a rename or the source of a copy
+	OldPath string
+	//Status is the status letter of the change, i.e. A, M, D, R or C
+	Status string
+	Binary bool
+}
+
+//parseNumstat parses the NUL separated raw and numstat entries of a
+//commit. Raw entries, i.e. ":100644 100644 9405325 0fdf397 R083", give
+//the status of the files and numstat entries, i.e. "1 0 X.java" separated
+//by tabs, their lines added and deleted. Renames and copies have their old
+//and new paths in the next fields, binary files have - as counts. Paths
+//are never quoted nor mangled
+func parseNumstat(stats string) ([]numstat, error) {
+
+	fields := strings.Split(stats, "\x00")
+	statuses := make(map[string]string)
+	files := []numstat{}
+
+	for i := 0; i < len(fields); i++ {
+
+		field := strings.TrimLeft(fields[i], "\n")
+
+		switch {
+		case field == "":
+			continue
+
+		case strings.HasPrefix(field, ":"):
+			raw := strings.Fields(field)
+			status := raw[len(raw)-1][:1]
+			//Renames and copies are followed by both paths
+			if status == "R" || status == "C" {
+				i++
+			}
+			i++
+			if i >= len(fields) {
+				return nil, errors.New("truncated raw entry: " + field)
+			}
+			statuses[fields[i]] = status
+
+		default:
+			counts := strings.SplitN(field, "\t", 3)
+			if len(counts) != 3 {
+				return nil, errors.New("malformed numstat entry: " + field)
+			}
+
+			file := numstat{Path: counts[2]}
+			if file.Path == "" {
+				if i+2 >= len(fields) {
+					return nil, errors.New("truncated numstat entry: " + field)
+				}
+				file.OldPath, file.Path = fields[i+1], fields[i+2]
+				i += 2
+			}
+
+			//Binary files have - - as counts
+			file.Binary = counts[0] == "-" && counts[1] == "-"
+			if !file.Binary {
+				file.Added, _ = strconv.Atoi(counts[0])
+				file.Deleted, _ = strconv.Atoi(counts[1])
+			}
+
+			files = append(files, file)
+		}
+	}
+
+	for i := range files {
+		files[i].Status = statuses[files[i].Path]
+	}
+
+	return files, nil
+}
+
+//parseRecord builds a commit out of a record of the log
+//and returns it with the files it modified
+func (git *CMD) parseRecord(record string, repositoryID int) (*pogo.Commit, []numstat, error) {
+
+	prettyCommitSplit := strings.SplitN(record, "BUMPER_STOPPRETTY", 2)
+	if len(prettyCommitSplit) != 2 {
+		return nil, nil, errors.New("malformed log record: " + record)
+	}
+
+	prettyCommit := prettyCommitSplit[0]
+	statsCommit := prettyCommitSplit[1]
+
+	prettyCommitDetails := strings.SplitN(prettyCommit, " BUMPER_DELIMITER2", 7)
+	if len(prettyCommitDetails) != 7 {
+		return nil, nil, errors.New("malformed log record: " + record)
+	}
+
+	commit := pogo.NewCommit(
+		strings.Fields(prettyCommitDetails[0]),
+		strings.Trim(prettyCommitDetails[1], " "),
+		strings.Trim(prettyCommitDetails[2], " "),
+		strings.Trim(prettyCommitDetails[3], " "),
+		strings.Trim(prettyCommitDetails[4], " "),
+		strings.Trim(prettyCommitDetails[5], " "),
+		strings.Trim(prettyCommitDetails[6], " "),
+		git.FixExtractor,
+		git.ReviewerExtractor,
+		git.IsP4,
+		repositoryID)
+
+	git.classifyMerge(commit)
+
+	stats, err := parseNumstat(statsCommit)
+	if err != nil {
+		return nil, nil, errors.New(commit.CommitHash + ": " + err.Error())
+	}
+
+	return commit, stats, nil
+}
+
+//developers returns the resolver of the developers of repoDir, knowing the
+//ones of state. The alias file comes first, then the .mailmap of HEAD
+func (git *CMD) developers(repoDir string, state *MetricState) *identity.Resolver {
+
+	resolver := identity.NewResolver(state.Identities)
+	state.Identities = resolver.Known
+
+	if git.AliasFile != "" {
+		aliases, err := ioutil.ReadFile(git.AliasFile)
+		if err != nil {
+			fmt.Println("Could not read the alias file", git.AliasFile, err.Error())
+		}
+		resolver.AddMailmap(string(aliases))
+	}
+
+	//Most repositories don't have one
+	mailmap, _ := git.Backend.Show(context.Background(), repoDir, "HEAD:.mailmap")
+	resolver.AddMailmap(string(mailmap))
+
+	return resolver
+}
+
+//StreamCommits parses the git log read from r and sends its commits, along
+//with their metrics, on the returned channel as soon as they are decoded.
+//The channel is buffered by StreamBuffer commits: a slow consumer pauses
+//the parsing. The error channel receives the parsing error, if any, and is
+//closed with the commit channel. The metrics are computed against state,
+//which is updated as commits are parsed. Merges are measured following
+//git.MergePolicy, against their merge base in repoDir if need be
+func (git *CMD) StreamCommits(r io.Reader, repoDir string, repositoryID int, state *MetricState) (<-chan *pogo.Commit, <-chan error) {
+
+	commits := make(chan *pogo.Commit, StreamBuffer)
+	errs := make(chan error, 1)
+
+	go func() {
+
+		defer close(errs)
+		defer close(commits)
+
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxRecordSize)
+		scanner.Split(scanRecords)
+
+		developers := git.developers(repoDir, state)
+
+		for scanner.Scan() {
+
+			commit, stats, err := git.parseRecord(scanner.Text(), repositoryID)
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			if commit.IsMerge() && git.skipsMerges() {
+				stats = nil
+			} else if commit.IsMerge() && git.MergePolicy == MergeBase {
+				if stats, err = git.mergeStats(repoDir, commit); err != nil {
+					errs <- err
+					return
+				}
+			}
+
+			commit.AuthorID = developers.Resolve(commit.AuthorName, commit.AuthorEmail).ID
+
+			git.commitStats(
+				stats,
+				state,
+				commit.AuthorID,
+				commit.AuthorDateUnixTimestamp,
+				commit)
+
+			state.Hash = commit.CommitHash
+			commits <- commit
+		}
+
+		if err := scanner.Err(); err != nil {
+			errs <- err
+		}
+	}()
+
+	return commits, errs
+}
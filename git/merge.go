@@ -0,0 +1,161 @@
+package git
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mathieunls/deepchange-downloader/pogo"
+	gcache "github.com/mathieunls/gcache/src"
+)
+
+//Merge policies, how merge commits, octopus ones included,
+//are measured, classified and linked
+const (
+	//MergeSkip ignores the merges: they have no metrics, are classified
+	//as merges only and are neither fixes nor bug-introducing changes
+	MergeSkip = "skip"
+	//MergeFirstParent measures and links the merges against their
+	//first parent, i.e. what they bring to the mainline
+	MergeFirstParent = "first-parent"
+	//MergeBase measures and links the merges against the merge
+	//base of their parents, i.e. all the merged changes
+	MergeBase = "merge-base"
+	//MergeBranch skips the merges as MergeSkip does but the reports
+	//they fix are fixed by the commits of the branches they merge
+	MergeBranch = "branch"
+)
+
+//MergePolicies are the known merge policies
+var MergePolicies = []string{MergeSkip, MergeFirstParent, MergeBase, MergeBranch}
+
+//skipsMerges returns whether the merges are left out of the metrics and SZZ
+func (git *CMD) skipsMerges() bool {
+	return git.MergePolicy == MergeSkip || git.MergePolicy == MergeBranch
+}
+
+//classifyMerge classifies the merge commit as a merge when it is skipped.
+//The reports of a skipped merge are kept for the merged branch only
+func (git *CMD) classifyMerge(commit *pogo.Commit) {
+
+	if !commit.IsMerge() || !git.skipsMerges() {
+		return
+	}
+
+	commit.Classification = map[string]float64{
+		"merge": 100.0,
+	}
+
+	if git.MergePolicy == MergeSkip {
+		commit.FixReportIDs = []string{}
+	}
+}
+
+//parentRevision returns the revision commit is compared with to find the lines
+//it modified: its first parent or, for merges measured against their merge
+//base, the merge base of their parents
+func (git *CMD) parentRevision(ctx context.Context, commit *pogo.Commit, repoDir string) string {
+
+	if !commit.IsMerge() || git.MergePolicy != MergeBase {
+		return commit.CommitHash + "^"
+	}
+
+	if cached := gcache.GetCacheInstance().Fetch("merge_base", commit.CommitHash); cached != nil {
+		return cached.(string)
+	}
+
+	base, err := git.Backend.MergeBase(ctx, repoDir, commit.ParentHashes...)
+	if err != nil {
+		fmt.Println("There was an error running git merge-base command:", err.Error())
+		return commit.CommitHash + "^"
+	}
+
+	gcache.GetCacheInstance().Put("merge_base", commit.CommitHash, base)
+
+	return base
+}
+
+//mergeStats returns the files modified by the merge since the merge base of its parents
+func (git *CMD) mergeStats(repoDir string, commit *pogo.Commit) ([]numstat, error) {
+
+	ctx := context.Background()
+
+	out, err := git.Backend.Diff(ctx, repoDir, "-z", "--raw", "--numstat", "-M",
+		git.parentRevision(ctx, commit, repoDir), commit.CommitHash, "--")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseNumstat(string(out))
+}
+
+//branchFixes gives the reports fixed by the merges to the commits of the branches
+//they merge, i.e. the pull requests, and returns the commits becoming corrective.
+//Only the commits part of commits get the reports
+func (git *CMD) branchFixes(repoDir string, commits []*pogo.Commit) []*pogo.Commit {
+
+	byHash := make(map[string]*pogo.Commit)
+	for _, commit := range commits {
+		byHash[commit.CommitHash] = commit
+	}
+
+	corrective := []*pogo.Commit{}
+
+	for _, merge := range commits {
+
+		if !merge.IsMerge() || len(merge.FixReportIDs) == 0 {
+			continue
+		}
+
+		//The commits reachable from the merged parents but not from the first one
+		args := []string{"--format=%H", "^" + merge.ParentHashes[0]}
+		stream, err := git.Backend.Log(context.Background(), repoDir, append(args, merge.ParentHashes[1:]...)...)
+		if err != nil {
+			fmt.Println("There was an error running git log command:", err.Error())
+			continue
+		}
+
+		scanner := bufio.NewScanner(stream)
+		for scanner.Scan() {
+
+			commit, present := byHash[strings.TrimSpace(scanner.Text())]
+			if !present || commit.IsMerge() {
+				continue
+			}
+
+			wasCorrective := len(commit.Classification) == 1 && commit.Classification["corrective"] == 100.0
+
+			for _, reportID := range merge.FixReportIDs {
+				if !contains(commit.FixReportIDs, reportID) {
+					commit.FixReportIDs = append(commit.FixReportIDs, reportID)
+				}
+			}
+
+			if !wasCorrective {
+				commit.Classification = map[string]float64{
+					"corrective": 100.0,
+				}
+				corrective = append(corrective, commit)
+			}
+		}
+
+		if err = stream.Close(); err != nil {
+			fmt.Println("There was an error running git log command:", err.Error())
+		}
+	}
+
+	return corrective
+}
+
+//contains returns whether value is one of values
+func contains(values []string, value string) bool {
+
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
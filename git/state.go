@@ -0,0 +1,140 @@
+package git
+
+import (
+	"encoding/gob"
+	"os"
+
+	"github.com/mathieunls/deepchange-downloader/pogo"
+)
+
+//metricStateVersion changes with the content of the state,
+//states of other versions are computed again
+const metricStateVersion = 4
+
+//MetricState holds the per-file and per-developer history the
+//metrics of the next commits are computed against
+type MetricState struct {
+	Version int
+	//Hash of the last commit accounted for
+	Hash        string
+	CommitFiles map[string]commitFile
+	DevExp      map[string]devExperiences
+	//Developers by email and by name, see identity.Resolver
+	Identities map[string]string
+	//Changes of the entropy window, oldest first
+	Window []fileChange
+	//Fixes ingested but not linked yet, linked by the next run
+	Unlinked []unlinkedFix
+	//Hashes of the ref tips accounted for, when ingesting all the refs
+	Tips []string
+}
+
+//unlinkedFix is what linking a fix requires
+type unlinkedFix struct {
+	Hash         string
+	ParentHashes []string
+	FixReportIDs []string
+}
+
+//NewMetricState returns the state of an empty history
+func NewMetricState() *MetricState {
+
+	return &MetricState{
+		Version:     metricStateVersion,
+		CommitFiles: make(map[string]commitFile),
+		DevExp:      make(map[string]devExperiences),
+		Identities:  make(map[string]string),
+	}
+}
+
+//unlinkedCommits returns the fixes left unlinked, as
+//commits of repositoryID holding what linking requires
+func (state *MetricState) unlinkedCommits(repositoryID int) []*pogo.Commit {
+
+	commits := []*pogo.Commit{}
+
+	for _, fix := range state.Unlinked {
+		commits = append(commits, &pogo.Commit{
+			CommitHash:     fix.Hash,
+			ParentHashes:   fix.ParentHashes,
+			FixReportIDs:   fix.FixReportIDs,
+			RepositoryID:   repositoryID,
+			Classification: map[string]float64{"corrective": 100.0},
+		})
+	}
+
+	return commits
+}
+
+//setUnlinked records fixes as unlinked, but the linked ones
+func (state *MetricState) setUnlinked(fixes []*pogo.Commit) {
+
+	state.Unlinked = []unlinkedFix{}
+
+	for _, fix := range fixes {
+		if !fix.Linked {
+			state.Unlinked = append(state.Unlinked, unlinkedFix{fix.CommitHash, fix.ParentHashes, fix.FixReportIDs})
+		}
+	}
+}
+
+//removeLinked removes the linked fixes from the unlinked ones
+func (state *MetricState) removeLinked(fixes []*pogo.Commit) {
+
+	linked := make(map[string]struct{})
+	for _, fix := range fixes {
+		if fix.Linked {
+			linked[fix.CommitHash] = struct{}{}
+		}
+	}
+
+	unlinked := []unlinkedFix{}
+	for _, fix := range state.Unlinked {
+		if _, present := linked[fix.Hash]; !present {
+			unlinked = append(unlinked, fix)
+		}
+	}
+
+	state.Unlinked = unlinked
+}
+
+//loadState reads the state stored in path, nil if there is none or
+//if it isn't the state of hash, whatever its hash if hash is empty
+func loadState(path string, hash string) *MetricState {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	state := NewMetricState()
+	if err = gob.NewDecoder(file).Decode(state); err != nil ||
+		state.Version != metricStateVersion || (hash != "" && state.Hash != hash) {
+		return nil
+	}
+
+	return state
+}
+
+//save stores the state in path
+func (state *MetricState) save(path string) error {
+
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+
+	err = gob.NewEncoder(file).Encode(state)
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,96 @@
+package git
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	classifier "github.com/mathieunls/deepchange-downloader/classifiers"
+)
+
+//SZZ variants locating the bugs fixed by a commit
+const (
+	//SZZOriginal blames every line modified or deleted by the fix
+	SZZOriginal = "original"
+	//SZZRefined doesn't blame the lines of a fix that only change
+	//whitespaces, comments or imports
+	SZZRefined = "refined"
+)
+
+//SZZVariants lists the known SZZ variants
+var SZZVariants = []string{SZZOriginal, SZZRefined}
+
+//hunkLine is a line deleted or added by a hunk
+type hunkLine struct {
+	Number  int
+	Content string
+}
+
+//hunkRegions returns the numbers of the lines deleted by a hunk of a file
+//of language that are bug locations w/ regards to the SZZ variant
+func (git *CMD) hunkRegions(language string, deleted []hunkLine, added []hunkLine) []string {
+
+	regions := []string{}
+
+	if git.SZZ != SZZRefined {
+		for _, line := range deleted {
+			regions = append(regions, strconv.Itoa(line.Number))
+		}
+		return regions
+	}
+
+	syntax := classifier.GetInstance().Syntax(language)
+
+	deletedCode, deletedImports := normalizedCode(syntax, deleted)
+	addedCode, _ := normalizedCode(syntax, added)
+
+	//The hunk only reformats or comments the code
+	if strings.Join(deletedCode, "") == strings.Join(addedCode, "") {
+		return regions
+	}
+
+	kept := make(map[string]struct{})
+	for _, code := range addedCode {
+		kept[code] = struct{}{}
+	}
+
+	for i, line := range deleted {
+
+		//Blank or comment lines, imports and
+		//lines only re-indented by the hunk
+		if _, present := kept[deletedCode[i]]; deletedCode[i] == "" || deletedImports[i] || present {
+			continue
+		}
+
+		regions = append(regions, strconv.Itoa(line.Number))
+	}
+
+	return regions
+}
+
+//normalizedCode returns the code of the lines without comments and
+//whitespaces, along with whether each line is an import
+func normalizedCode(syntax *classifier.Syntax, lines []hunkLine) ([]string, []bool) {
+
+	codes := make([]string, len(lines))
+	imports := make([]bool, len(lines))
+	inBlock := false
+
+	for i, line := range lines {
+
+		code := line.Content
+		if syntax != nil {
+			code, inBlock = syntax.Code(code, inBlock)
+			imports[i] = syntax.IsImport(code)
+		}
+
+		codes[i] = strings.Map(func(r rune) rune {
+			if unicode.IsSpace(r) {
+				return -1
+			}
+			return r
+		}, code)
+	}
+
+	return codes, imports
+}
@@ -0,0 +1,115 @@
+package git
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/mathieunls/deepchange-downloader/pogo"
+)
+
+//Time filter modes applied to the bug-introducing candidates
+const (
+	//TimeFilterOff accepts every candidate
+	TimeFilterOff = "off"
+	//TimeFilterFlag accepts every candidate but reports the ones
+	//authored after the fixed report was opened as suspicious
+	TimeFilterFlag = "flag"
+	//TimeFilterDiscard rejects the candidates authored after the
+	//fixed report was opened and reports them as suspicious
+	TimeFilterDiscard = "discard"
+)
+
+//TimeFilters lists the known time filter modes
+var TimeFilters = []string{TimeFilterOff, TimeFilterFlag, TimeFilterDiscard}
+
+//Suspicion is a bug-introducing candidate of a fix that can't have
+//introduced the fixed bug, as it was authored after the bug was reported
+type Suspicion struct {
+	RepositoryID  int
+	Candidate     string
+	Fix           string
+	CandidateDate time.Time
+	ReportID      string
+	ReportDate    time.Time
+	Discarded     bool
+	Reason        string
+}
+
+//timeFilter splits the candidates blamed for fix between the accepted
+//ones and the suspicious ones, authored after the earliest report fixed by
+//fix was opened. Without report or date, every candidate is accepted
+func (git *CMD) timeFilter(fix *pogo.Commit, candidates map[string][]blameLine) (map[string][]blameLine, []Suspicion) {
+
+	if git.TimeFilter == TimeFilterOff || git.TimeFilter == "" {
+		return candidates, nil
+	}
+
+	reportID, reportDate, found := earliestReport(fix.FixReports)
+	if !found {
+		return candidates, nil
+	}
+
+	accepted := make(map[string][]blameLine)
+	suspicious := []Suspicion{}
+
+	for hash, lines := range candidates {
+
+		candidateDate := time.Unix(int64(lines[0].AuthorTime), 0).UTC()
+
+		if !candidateDate.After(reportDate) || lines[0].AuthorTime == 0 {
+			accepted[hash] = lines
+			continue
+		}
+
+		suspicion := Suspicion{
+			RepositoryID:  fix.RepositoryID,
+			Candidate:     hash,
+			Fix:           fix.CommitHash,
+			CandidateDate: candidateDate,
+			ReportID:      reportID,
+			ReportDate:    reportDate,
+			Discarded:     git.TimeFilter == TimeFilterDiscard,
+			Reason: "authored " + candidateDate.Format(time.RFC3339) + ", " +
+				candidateDate.Sub(reportDate).Round(time.Second).String() + " after report " +
+				reportID + " was opened on " + reportDate.Format(time.RFC3339),
+		}
+
+		suspicious = append(suspicious, suspicion)
+
+		if !suspicion.Discarded {
+			accepted[hash] = lines
+		}
+	}
+
+	return accepted, suspicious
+}
+
+//earliestReport returns the external id and the open date of the
+//earliest report having a known date, found is false if there's none
+func earliestReport(reports []pogo.Report) (string, time.Time, bool) {
+
+	reportID := ""
+	earliest := time.Time{}
+	found := false
+
+	for _, report := range reports {
+
+		attributes := report.Attributes()
+
+		date, err := attributes.OpenDate()
+		if err != nil {
+			continue
+		}
+
+		if !found || date.Before(earliest) {
+			reportID = attributes.ExternalID
+			if reportID == "" {
+				reportID = strconv.FormatInt(attributes.ID, 10)
+			}
+			earliest = date
+			found = true
+		}
+	}
+
+	return reportID, earliest, found
+}
@@ -0,0 +1,196 @@
+package identity
+
+import (
+	"sort"
+	"strings"
+)
+
+//Identity is a developer, whatever the names and emails used
+type Identity struct {
+	//ID is stable across runs, it is the normalized email the
+	//developer was first seen with, or the name without email
+	ID    string
+	Name  string
+	Email string
+}
+
+//mapping is a line of a .mailmap file, mapping the commits of
+//CommitEmail, and CommitName if set, to ProperName and ProperEmail
+type mapping struct {
+	ProperName  string
+	ProperEmail string
+	CommitName  string
+	CommitEmail string
+}
+
+//Resolver resolves the authors of the commits to developers. The .mailmap
+//files and the alias files come first, then emails and names seen before
+type Resolver struct {
+	mailmap []mapping
+	//Known maps the normalized emails and names seen so far
+	//to their developer ID, it is kept between runs
+	Known map[string]string
+}
+
+//NewResolver returns a resolver knowing the developers of known,
+//a new map if nil. The resolver adds the developers it meets to it
+func NewResolver(known map[string]string) *Resolver {
+
+	if known == nil {
+		known = make(map[string]string)
+	}
+
+	return &Resolver{Known: known}
+}
+
+//AddMailmap adds the lines of a .mailmap file, of lesser priority than
+//the ones added before. A line maps the commits of an email, and of a name
+//if given, to a proper name, a proper email or both, see git-check-mailmap.
+//Alias files have the same syntax
+func (resolver *Resolver) AddMailmap(content string) {
+
+	for _, line := range strings.Split(content, "\n") {
+
+		if i := strings.Index(line, "#"); i != -1 {
+			line = line[:i]
+		}
+
+		names, emails := []string{}, []string{}
+
+		for {
+			open := strings.Index(line, "<")
+			end := strings.Index(line, ">")
+			if open == -1 || end < open {
+				break
+			}
+
+			names = append(names, strings.TrimSpace(line[:open]))
+			emails = append(emails, line[open+1:end])
+			line = line[end+1:]
+		}
+
+		switch len(emails) {
+		case 1:
+			resolver.mailmap = append(resolver.mailmap, mapping{names[0], "", "", emails[0]})
+		case 2:
+			resolver.mailmap = append(resolver.mailmap, mapping{names[0], emails[0], names[1], emails[1]})
+		}
+	}
+}
+
+//Resolve returns the developer authoring as name and email. Emails are
+//matched case insensitively, without +tags, and full names, first and
+//last, are matched whatever their case, punctuation and order
+func (resolver *Resolver) Resolve(name string, email string) Identity {
+
+	developer := Identity{Name: name, Email: email}
+
+	//A proper email is the developer, whatever was seen before
+	authoritative := false
+
+	for _, line := range resolver.mailmap {
+
+		if !strings.EqualFold(line.CommitEmail, email) ||
+			(line.CommitName != "" && !strings.EqualFold(line.CommitName, name)) {
+			continue
+		}
+
+		if line.ProperName != "" {
+			developer.Name = line.ProperName
+		}
+		if line.ProperEmail != "" {
+			developer.Email = line.ProperEmail
+			authoritative = true
+		}
+
+		break
+	}
+
+	keys := []string{}
+	emailKey, nameKey := "", ""
+
+	if email := normalizeEmail(developer.Email); email != "" {
+		emailKey = "email:" + email
+		keys = append(keys, emailKey)
+	}
+
+	//Single words are too common to be a developer, i.e. root or admin
+	if name := normalizeName(developer.Name); strings.Contains(name, " ") {
+		nameKey = "name:" + name
+		keys = append(keys, nameKey)
+	}
+
+	//The email of the commit belongs to the developer too
+	if email := normalizeEmail(email); email != "" {
+		keys = append(keys, "email:"+email)
+	}
+
+	id := ""
+	if authoritative {
+		id = strings.TrimPrefix(emailKey, "email:")
+	}
+	if id == "" && emailKey != "" {
+		id = resolver.Known[emailKey]
+	}
+	if id == "" && nameKey != "" {
+		id = resolver.Known[nameKey]
+	}
+	if id == "" {
+		id = strings.TrimPrefix(emailKey, "email:")
+	}
+	if id == "" {
+		id = normalizeName(developer.Name)
+	}
+
+	for _, key := range keys {
+		if _, known := resolver.Known[key]; !known || authoritative {
+			resolver.Known[key] = id
+		}
+	}
+
+	developer.ID = id
+
+	return developer
+}
+
+//normalizeEmail lowercases email and drops the +tag of its local
+//part, i.e. jane+git@example.com is jane@example.com. GitHub's
+//12345+jane@users.noreply.github.com is jane@users.noreply.github.com
+func normalizeEmail(email string) string {
+
+	email = strings.ToLower(strings.Trim(strings.TrimSpace(email), "<>"))
+
+	at := strings.LastIndex(email, "@")
+	if at == -1 {
+		return email
+	}
+
+	local, domain := email[:at], email[at+1:]
+
+	if plus := strings.Index(local, "+"); plus != -1 {
+		if domain == "users.noreply.github.com" {
+			local = local[plus+1:]
+		} else {
+			local = local[:plus]
+		}
+	}
+
+	return local + "@" + domain
+}
+
+//normalizeName lowercases name, replaces its punctuation by spaces and
+//sorts its words, so "John Smith", "Smith John" and "Smith, John" match
+func normalizeName(name string) string {
+
+	name = strings.Map(func(r rune) rune {
+		if r == '.' || r == ',' || r == '_' || r == '-' || r == '"' || r == '\'' {
+			return ' '
+		}
+		return r
+	}, strings.ToLower(name))
+
+	words := strings.Fields(name)
+	sort.Strings(words)
+
+	return strings.Join(words, " ")
+}
@@ -30,10 +30,10 @@ type XMLJiraLinker struct {
 }
 
 //Fetch fetches a report using mysql
-//It expects ids to look like ACE-234430
+//It expects ids to look like ACE-234430 or 234430
 func (linker *MySQLJiraLinker) Fetch(id string) (pogo.Report, error) {
 
-	id = strings.Split(id, "-")[1]
+	id = id[strings.LastIndex(id, "-")+1:]
 
 	report, err := NewSQL(linker.Db, linker.ProjectKey, id, linker.DatabaseName)
 
@@ -44,6 +44,11 @@ func (linker *MySQLJiraLinker) DBName() string {
 	return linker.DatabaseName
 }
 
+//Cached returns the report cached as attributes
+func (linker *MySQLJiraLinker) Cached(attributes pogo.ReportAttributes) pogo.Report {
+	return &Report{ReportAttributes: attributes}
+}
+
 func (report *Report) Attributes() *pogo.ReportAttributes {
 	return &report.ReportAttributes
 }
@@ -84,6 +84,49 @@ func findPeople(email string, lastname string, firstname string, ssoID string, D
 	return peopleID
 }
 
+//findDeveloper returns the people of the developer identified by id, see
+//identity.Resolver, whatever the email used. The id is stored as sso_id
+func findDeveloper(id string, email string, name string, Db *sql.DB) int64 {
+
+	if people := gcache.GetCacheInstance().Fetch("developer", id); people != nil {
+		return people.(*peopleStruct).ID
+	}
+
+	var peopleID int64
+	stmSel, err := Db.Prepare(sqlPeopleSelectBySSOID)
+	if err != nil {
+		panic(err.Error())
+	}
+	err = stmSel.QueryRow(id).Scan(&peopleID)
+	stmSel.Close()
+	switch {
+	case err == sql.ErrNoRows:
+
+		stmIns, err := Db.Prepare(sqlPeopleInsert)
+		if err != nil {
+			panic(err.Error())
+		}
+		result, err := stmIns.Exec(
+			name,
+			"",
+			email,
+			id)
+		if err != nil {
+			panic(err.Error())
+		}
+
+		peopleID, err = result.LastInsertId()
+		stmIns.Close()
+
+	case err != nil:
+		log.Fatal(err)
+	}
+
+	cachePeople(peopleID, email, name, "", id)
+
+	return peopleID
+}
+
 func findWords(words []*wordStruct, Db *sql.DB) []*wordStruct {
 
 	var cachedWords []*wordStruct
@@ -274,13 +317,20 @@ func cachePeople(
 	lastname string, firstname string,
 	ssoID string) {
 
-	gcache.GetCacheInstance().Put("people", email, &peopleStruct{
+	people := &peopleStruct{
 		ID:        peopleID,
 		Email:     email,
 		Lastname:  lastname,
 		Firstname: firstname,
 		SsoID:     ssoID,
-	})
+	}
+
+	gcache.GetCacheInstance().Put("people", email, people)
+
+	//The developers resolved by identity.Resolver, by id
+	if ssoID != "" {
+		gcache.GetCacheInstance().Put("developer", ssoID, people)
+	}
 }
 
 func cacheWord(word string, gram int, wordID int64) {
@@ -420,6 +470,8 @@ func WarmupCache(Db *sql.DB, logDirs []string) {
 
 			if strings.Index(file.Name(), "diff_") == 0 {
 				store = "diff"
+			} else if strings.Index(file.Name(), "unified_diff_") == 0 {
+				store = "unified_diff"
 			} else if strings.Index(file.Name(), "file_modified_diff_") == 0 {
 				store = "file_modified_diff"
 			} else if strings.Index(file.Name(), "blame_") == 0 {
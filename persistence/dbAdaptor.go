@@ -7,6 +7,8 @@ type DBAdaptor interface {
 	IsBuggy(*pogo.Commit, int)
 	SyncReports(reports []pogo.Report, repoID int, commitHash string)
 	IsLinked(*pogo.Commit, int)
+	Watermark(repoID int) string
+	SyncWatermark(repoID int, hash string)
 }
 
 var sqlCommitInsert = `INSERT INTO bumper.commit
@@ -42,6 +44,11 @@ var sqlPeopleSelectByEmail = `SELECT id
 							  where email = ?
 							  LIMIT 1`
 
+var sqlPeopleSelectBySSOID = `SELECT id
+							  FROM people
+							  where sso_id = ?
+							  LIMIT 1`
+
 var sqlPeopleInsert = `INSERT INTO people
 						(
 							lastname,
@@ -147,4 +154,50 @@ var sqlInsertFix = `INSERT INTO commit_fix
 					VALUES
 					(?, ?);`
 
+var sqlInsertFixProvenance = `INSERT INTO commit_fix_provenance
+					(
+					buggy_commit_id,
+					fixing_commit_id,
+					file,
+					line,
+					original_file,
+					original_line,
+					content,
+					szz)
+					VALUES
+					(?, ?, ?, ?, ?, ?, ?, ?);`
+
+var sqlCreateFixProvenance = `CREATE TABLE IF NOT EXISTS commit_fix_provenance
+					(
+					id INT NOT NULL AUTO_INCREMENT,
+					buggy_commit_id INT NOT NULL,
+					fixing_commit_id INT NOT NULL,
+					file VARCHAR(1024) NOT NULL,
+					line INT NOT NULL,
+					original_file VARCHAR(1024) NOT NULL,
+					original_line INT NOT NULL,
+					content TEXT,
+					szz VARCHAR(32) NOT NULL,
+					PRIMARY KEY (id),
+					KEY buggy_commit_id (buggy_commit_id),
+					KEY fixing_commit_id (fixing_commit_id)
+					);`
+
 var sqlInsertCommitReport = `Insert into commit_report (commit_id, report_id) VALUES`
+
+var sqlCreateWatermark = `CREATE TABLE IF NOT EXISTS repository_watermark
+						(
+						repository_id INT NOT NULL,
+						hash VARCHAR(64) NOT NULL,
+						PRIMARY KEY (repository_id)
+						);`
+
+var sqlSelectWatermark = `SELECT hash FROM repository_watermark WHERE repository_id = ? LIMIT 1`
+
+var sqlUpsertWatermark = `INSERT INTO repository_watermark
+						(
+						repository_id,
+						hash)
+						VALUES
+						(?, ?)
+						ON DUPLICATE KEY UPDATE hash = VALUES(hash);`
@@ -27,6 +27,14 @@ func (mysql *MySQLAdaptor) SyncCommit(commit *pogo.Commit) {
 	mysql.nbCommit++
 	fmt.Println("Saving commit", commit.CommitHash, "("+strconv.Itoa(mysql.nbCommit)+")")
 
+	//One people per developer, whatever the emails used
+	var author int64
+	if commit.AuthorID != "" {
+		author = findDeveloper(helper.UTF8String(commit.AuthorID), helper.UTF8String(commit.AuthorEmail), helper.UTF8String(commit.AuthorName), mysql.Db)
+	} else {
+		author = findPeople(helper.UTF8String(commit.AuthorEmail), helper.UTF8String(commit.AuthorName), "", "", mysql.Db)
+	}
+
 	stmIns, err := mysql.Db.Prepare(sqlCommitInsert)
 	if err != nil {
 		panic(err.Error())
@@ -52,7 +60,7 @@ func (mysql *MySQLAdaptor) SyncCommit(commit *pogo.Commit) {
 		commit.Sexp,
 		commit.P4Path,
 		commit.P4CL,
-		findPeople(helper.UTF8String(commit.AuthorEmail), helper.UTF8String(commit.AuthorName), "", "", mysql.Db),
+		author,
 		commit.RepositoryID,
 		commit.AuthorDateUnixTimestamp)
 
@@ -360,6 +368,35 @@ func (mysql *MySQLAdaptor) IsBuggy(commit *pogo.Commit, repoID int) {
 		stmt.Close()
 	}
 
+	//The lines of the fixes blamed on the commit
+	if len(commit.FixProvenances) > 0 {
+		mysql.createTable("commit_fix_provenance", sqlCreateFixProvenance)
+	}
+
+	for _, provenance := range commit.FixProvenances {
+
+		stmt, err = mysql.Db.Prepare(sqlInsertFixProvenance)
+
+		if err != nil {
+			panic(err.Error())
+		}
+		_, err = stmt.Exec(
+			findCommit(commit.CommitHash, repoID, mysql.Db).ID,
+			findCommit(provenance.FixHash, repoID, mysql.Db).ID,
+			provenance.File,
+			provenance.Line,
+			provenance.OriginalFile,
+			provenance.OriginalLine,
+			provenance.Content,
+			provenance.SZZ,
+		)
+		if err != nil {
+			panic(err.Error())
+		}
+
+		stmt.Close()
+	}
+
 }
 
 func (mysql *MySQLAdaptor) IsLinked(commit *pogo.Commit, repoID int) {
@@ -382,3 +419,50 @@ func (mysql *MySQLAdaptor) IsLinked(commit *pogo.Commit, repoID int) {
 	}
 
 }
+
+//Watermark returns the hash of the last commit ingested
+//for the repository, empty if none was
+func (mysql *MySQLAdaptor) Watermark(repoID int) string {
+
+	mysql.createTable("repository_watermark", sqlCreateWatermark)
+
+	var hash string
+
+	err := mysql.Db.QueryRow(sqlSelectWatermark, repoID).Scan(&hash)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return ""
+	case err != nil:
+		panic(err.Error())
+	}
+
+	return hash
+}
+
+//SyncWatermark records hash as the last commit ingested for the repository
+func (mysql *MySQLAdaptor) SyncWatermark(repoID int, hash string) {
+
+	fmt.Println("Saving watermark", hash, "for repository", repoID)
+
+	mysql.createTable("repository_watermark", sqlCreateWatermark)
+
+	if _, err := mysql.Db.Exec(sqlUpsertWatermark, repoID, hash); err != nil {
+		panic(err.Error())
+	}
+}
+
+//createTable creates the table name with ddl once per run, if it doesn't
+//exist. Tables added after the original schema are created on first use
+func (mysql *MySQLAdaptor) createTable(name string, ddl string) {
+
+	if mysql.Cache.Fetch("table", name) != nil {
+		return
+	}
+
+	if _, err := mysql.Db.Exec(ddl); err != nil {
+		panic(err.Error())
+	}
+
+	mysql.Cache.Put("table", name, true)
+}
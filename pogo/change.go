@@ -4,6 +4,7 @@ package pogo
 type Change interface {
 	NewCommit(parentHashes []string, commitHash string, authorName string,
 		authorEmail string, authorDate string, authorDateUnixTimestamp string,
-		message string, regexFix string, regexReviewer string, isP4 bool) *Change
+		message string, fixExtractor ReferenceExtractor,
+		reviewerExtractor ReferenceExtractor, isP4 bool) *Change
 	String() string
 }
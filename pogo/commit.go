@@ -18,6 +18,7 @@ type Commit struct {
 	AuthorName              string
 	AuthorDateUnixTimestamp int
 	AuthorEmail             string
+	AuthorID                string
 	AuthorDate              string
 	Reviewers               []string
 	CommitMessage           string
@@ -26,15 +27,26 @@ type Commit struct {
 	Linked                  bool
 	ContainsBug             bool
 	FixHashes               []string
+	FixProvenances          []FixProvenance
 	FixReportIDs            []string
 	FixReports              []Report
 	Subsystems              int
 	Directories             int
 	Files                   int
 	Entrophy                float64
+	HistoryEntrophy         float64
 	LineAdded               int
 	LineDeleted             int
+	ProductionLineAdded     int
+	ProductionLineDeleted   int
+	ProductionFiles         int
+	ProductionSubsystems    int
+	TestLineAdded           int
+	TestLineDeleted         int
+	TestFiles               int
+	TestSubsystems          int
 	FilesChanged            []string
+	BinaryFiles             []string
 	LineTotal               float64
 	Devs                    int
 	Age                     float64
@@ -47,10 +59,31 @@ type Commit struct {
 	P4CL                    string
 }
 
+//FixProvenance is a line of a fix blamed on a bug-introducing commit,
+//the evidence of the link between the two commits
+type FixProvenance struct {
+	FixHash string
+	//File and Line locate the line in the parent of the fix
+	File    string
+	Line    int
+	Content string
+	//OriginalFile and OriginalLine locate the line in the
+	//bug-introducing commit, they differ on moves and renames
+	OriginalFile string
+	OriginalLine int
+	SZZ          string
+}
+
+//IsMerge returns whether the commit merges two or more parents
+func (c *Commit) IsMerge() bool {
+	return len(c.ParentHashes) > 1
+}
+
 //NewCommit proerply handle the construction of a Git Commit
 func NewCommit(parentHashes []string, commitHash string, authorName string,
 	authorEmail string, authorDate string, authorDateUnixTimestamp string,
-	commitMessage string, regexFix string, regexReviewer string, isP4 bool,
+	commitMessage string, fixExtractor ReferenceExtractor,
+	reviewerExtractor ReferenceExtractor, isP4 bool,
 	repositoryID int) *Commit {
 
 	commit := Commit{}
@@ -71,33 +104,11 @@ func NewCommit(parentHashes []string, commitHash string, authorName string,
 		panic(err)
 	}
 
-	if len(commit.ParentHashes) == 2 {
-		commit.Classification = map[string]float64{
-			"merge": 100.0,
-		}
-	}
-
-	//Extracts the fixes w/ regards to regexFix
-	re := regexp.MustCompile(regexFix)
-	resultSlice := re.FindAllStringSubmatch(commit.CommitMessage, -1)
-	commit.FixReportIDs = []string{}
-	for index := 0; index < len(resultSlice); index++ {
-		if len(resultSlice[index]) == 4 {
-			commit.FixReportIDs = append(commit.FixReportIDs, resultSlice[index][3])
-		} else if len(resultSlice[index]) == 2 {
-			commit.FixReportIDs = append(commit.FixReportIDs, resultSlice[index][1])
-		}
-	}
+	//Extracts the fixes w/ regards to fixExtractor
+	commit.FixReportIDs = fixExtractor.Extract(commit.CommitMessage)
 
-	//Extracts the reviewers w/ regards to regexReviewer
-	commit.Reviewers = []string{}
-	re = regexp.MustCompile(regexReviewer)
-	resultSlice = re.FindAllStringSubmatch(commit.CommitMessage, -1)
-	for index := 0; index < len(resultSlice); index++ {
-		if len(resultSlice[index]) == 2 {
-			commit.Reviewers = append(commit.Reviewers, strings.Split(resultSlice[index][1], ",")...)
-		}
-	}
+	//Extracts the reviewers w/ regards to reviewerExtractor
+	commit.Reviewers = reviewerExtractor.Extract(commit.CommitMessage)
 
 	//Compute the classification
 	if len(commit.FixReportIDs) > 0 {
@@ -110,8 +121,8 @@ func NewCommit(parentHashes []string, commitHash string, authorName string,
 
 	//Extract P4 info if required
 	if isP4 {
-		re = regexp.MustCompile(`\[git-p4: depot-paths = "([a-zA-Z0-9/-_]+)": change = ([0-9]+)\]`)
-		resultSlice = re.FindAllStringSubmatch(commit.CommitMessage, -1)
+		re := regexp.MustCompile(`\[git-p4: depot-paths = "([a-zA-Z0-9/-_]+)": change = ([0-9]+)\]`)
+		resultSlice := re.FindAllStringSubmatch(commit.CommitMessage, -1)
 		for index := 0; index < len(resultSlice); index++ {
 
 			commit.P4Path = resultSlice[index][1]
@@ -131,6 +142,7 @@ func (c Commit) String() string {
 		"AuthorName: " + c.AuthorName + "\n" +
 		"AuthorDateUnixTimestamp: " + strconv.Itoa(c.AuthorDateUnixTimestamp) + "\n" +
 		"AuthorEmail: " + c.AuthorEmail + "\n" +
+		"AuthorID: " + c.AuthorID + "\n" +
 		"AuthorDate: " + c.AuthorDate + "\n" +
 		"Reviewers: " + strings.Join(c.Reviewers, ",") + "\n" +
 		"CommitMessage: " + c.CommitMessage + "\n" +
@@ -141,9 +153,19 @@ func (c Commit) String() string {
 		"Directories: " + strconv.Itoa(c.Directories) + "\n" +
 		"Files: " + strconv.Itoa(c.Files) + "\n" +
 		"Entrophy: " + strconv.FormatFloat(c.Entrophy, 'f', 6, 64) + "\n" +
+		"HistoryEntrophy: " + strconv.FormatFloat(c.HistoryEntrophy, 'f', 6, 64) + "\n" +
 		"LineAdded: " + strconv.Itoa(c.LineAdded) + "\n" +
 		"LineDeleted: " + strconv.Itoa(c.LineDeleted) + "\n" +
+		"ProductionLineAdded: " + strconv.Itoa(c.ProductionLineAdded) + "\n" +
+		"ProductionLineDeleted: " + strconv.Itoa(c.ProductionLineDeleted) + "\n" +
+		"ProductionFiles: " + strconv.Itoa(c.ProductionFiles) + "\n" +
+		"ProductionSubsystems: " + strconv.Itoa(c.ProductionSubsystems) + "\n" +
+		"TestLineAdded: " + strconv.Itoa(c.TestLineAdded) + "\n" +
+		"TestLineDeleted: " + strconv.Itoa(c.TestLineDeleted) + "\n" +
+		"TestFiles: " + strconv.Itoa(c.TestFiles) + "\n" +
+		"TestSubsystems: " + strconv.Itoa(c.TestSubsystems) + "\n" +
 		"FilesChanged: " + strings.Join(c.FilesChanged, ",") + "\n" +
+		"BinaryFiles: " + strings.Join(c.BinaryFiles, ",") + "\n" +
 		"LineTotal: " + strconv.FormatFloat(c.LineTotal, 'f', 6, 64) + "\n" +
 		"Devs: " + strconv.Itoa(c.Devs) + "\n" +
 		"Age: " + strconv.FormatFloat(c.Age, 'f', 6, 64) + "\n" +
@@ -0,0 +1,144 @@
+package pogo
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+//ReferenceExtractor extracts references, such as the ids of
+//fixed reports or the reviewers, from a commit message
+type ReferenceExtractor interface {
+	Extract(message string) []string
+}
+
+//Conventions maps the names of well-known referencing conventions
+//to their patterns. The reference is captured by the group named id
+var Conventions = map[string]string{
+	//@fix(ACE-1234) or @fixed ACE-1234
+	"bumper": `@fix(ed\()?( )?(?P<id>[a-zA-Z0-9]+-[0-9]+)`,
+	//@review(alice,bob)
+	"bumper-review": `@review\((?P<id>[a-z,]+)\)`,
+	//HBASE-1234, see JiraConvention
+	"jira": `\b(?P<id>[A-Z][A-Z0-9_]+-[0-9]+)\b`,
+	//Fixes #123, closes #123, resolved #123
+	"github": `(?i)\b(?:fix(?:e[sd])?|close[sd]?|resolve[sd]?):?\s+#(?P<id>[0-9]+)\b`,
+	//Bug 45678, bug #45678
+	"bugzilla": `(?i)\bbug\s*#?(?P<id>[0-9]+)\b`,
+	//Closes: #123 or Fixes: HBASE-1234 trailers
+	"closes": `(?im)^(?:closes|fixes|resolves):[ \t]*#?(?P<id>[^\s#]+)[ \t]*$`,
+	//Reviewed-by: Jane Doe <jane@example.org>
+	"gerrit-reviewed-by": `(?m)^Reviewed-by:[ \t]*(?:[^<\n]*<)?(?P<id>[^<>\n]+?)>?[ \t]*$`,
+}
+
+//JiraConvention returns the pattern of the jira convention
+//restricted to the given project key, i.e. HBASE
+func JiraConvention(projectKey string) string {
+	return `\b(?P<id>` + regexp.QuoteMeta(projectKey) + `-[0-9]+)\b`
+}
+
+//RegexExtractor extracts references matching any of its patterns.
+//The reference is the group named id or, for patterns without it,
+//the 3rd group of 3-groups patterns and the 1st group of 1-group ones
+type RegexExtractor struct {
+	patterns  []*regexp.Regexp
+	separator string
+}
+
+//NewFixExtractor returns an extractor of fixed report ids
+func NewFixExtractor(patterns ...string) (*RegexExtractor, error) {
+	return newRegexExtractor("", patterns)
+}
+
+//NewReviewerExtractor returns an extractor of reviewers where each
+//match can list several comma-separated reviewers
+func NewReviewerExtractor(patterns ...string) (*RegexExtractor, error) {
+	return newRegexExtractor(",", patterns)
+}
+
+func newRegexExtractor(separator string, patterns []string) (*RegexExtractor, error) {
+
+	extractor := &RegexExtractor{separator: separator}
+
+	for _, pattern := range patterns {
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		extractor.patterns = append(extractor.patterns, re)
+	}
+
+	return extractor, nil
+}
+
+//ConventionPatterns returns the patterns of the named conventions.
+//The jira convention is restricted to projectKey and fails without it:
+//any uppercase token such as UTF-8 or SHA-1 would be a report otherwise
+func ConventionPatterns(names []string, projectKey string) ([]string, error) {
+
+	patterns := []string{}
+
+	for _, name := range names {
+
+		pattern, present := Conventions[name]
+		if !present {
+			return nil, errors.New("unknown referencing convention " + name)
+		}
+
+		if name == "jira" {
+			if projectKey == "" {
+				return nil, errors.New("the jira convention requires a project key")
+			}
+			pattern = JiraConvention(projectKey)
+		}
+
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns, nil
+}
+
+//Extract returns the unique references found in message, pattern
+//after pattern
+func (extractor *RegexExtractor) Extract(message string) []string {
+
+	references := []string{}
+	seen := make(map[string]struct{})
+
+	for _, re := range extractor.patterns {
+
+		idIndex := re.SubexpIndex("id")
+
+		for _, match := range re.FindAllStringSubmatch(message, -1) {
+
+			reference := ""
+
+			if idIndex != -1 {
+				reference = match[idIndex]
+			} else if len(match) == 4 {
+				reference = match[3]
+			} else if len(match) == 2 {
+				reference = match[1]
+			}
+
+			values := []string{reference}
+			if extractor.separator != "" {
+				values = strings.Split(reference, extractor.separator)
+			}
+
+			for _, value := range values {
+
+				value = strings.TrimSpace(value)
+
+				if _, present := seen[value]; value != "" && !present {
+					seen[value] = struct{}{}
+					references = append(references, value)
+				}
+			}
+		}
+	}
+
+	return references
+}
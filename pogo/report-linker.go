@@ -5,4 +5,6 @@ package pogo
 type ReportLinker interface {
 	Fetch(string) (Report, error)
 	DBName() string
+	//Cached returns the report of the linker cached as its attributes
+	Cached(ReportAttributes) Report
 }
@@ -1,5 +1,11 @@
 package pogo
 
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
 //Report represents a bug report
 type Report interface {
 	String() string
@@ -15,8 +21,10 @@ type ReportAttributes struct {
 	Type        string
 	Title       string
 	Product     string
+	Component   string
 	Version     string
 	Severity    string
+	Resolution  string
 	Reporter    string
 	Assignee    string
 	Description string
@@ -24,6 +32,29 @@ type ReportAttributes struct {
 	Comments    []CommentAttribut
 }
 
+//dateLayouts are the layouts of the dates found in the trackers
+var dateLayouts = []string{
+	time.RFC1123Z,
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05",
+	time.RFC3339,
+	"2006-01-02",
+}
+
+//OpenDate returns the date the report was opened. Dates
+//without time zone, like the ones of MySQL, are taken as UTC
+func (attributes *ReportAttributes) OpenDate() (time.Time, error) {
+
+	for _, layout := range dateLayouts {
+		if date, err := time.Parse(layout, strings.TrimSpace(attributes.Date)); err == nil {
+			return date, nil
+		}
+	}
+
+	return time.Time{}, errors.New("unknown date format " + attributes.Date)
+}
+
 // func (report *Report) Words() map[string]float32 {
 
 // 	if report.words == nil {